@@ -0,0 +1,136 @@
+package rawpack
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Appender adds files to the end of existing archive. Each call of Pack or PackDir writes segment
+// with signature, file table and files, like archive created by Pack. Segments are read one after another,
+// see Reader.NextFileTable. Compressed archive is continued by new frames of the same codec,
+// it must be ZSTD, gzip, S2 or Snappy. Incomplete segment of failed Pack is truncated, so archive stays readable.
+//
+// OpenAppend of uncompressed archive (encrypted or not) reads only file tables of segments.
+// Compressed archive has no index of segments, so all its data is decompressed to find the end
+// of the last segment, time of OpenAppend grows with size of archive.
+type Appender struct {
+	f    *os.File
+	opts Options
+	seg  segment
+	// size is size of archive file before the next segment
+	size int64
+	err  error
+}
+
+// OpenAppend opens archive file name for appending of files with opts. The archive is checked
+// (compressed archive is read to the end, see Appender) to find its compression, which is used for appended files (opts.Zstd may set parameters of ZSTD).
+// ZSTD dictionary of archive is used for appended files. opts.Key must be the key of archive.
+func OpenAppend(ctx context.Context, name string, opts Options) (*Appender, error) {
+	f, err := os.OpenFile(name, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	a := &Appender{f: f, opts: opts}
+	if err := a.scan(ctx); err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	if a.size, err = f.Seek(0, io.SeekEnd); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return a, nil
+}
+
+// scan checks segments of archive and finds its compression, dictionary and uncompressed size
+func (a *Appender) scan(ctx context.Context) error {
+	info, err := a.f.Stat()
+	if err != nil {
+		return err
+	}
+	if a.opts.Codec == CodecFlate {
+		return fmt.Errorf("%w: files cannot be appended to archive compressed with flate", ErrUnsupportedCodec)
+	}
+	codec, dict, err := detectArchive(a.f, &a.opts)
+	if err != nil {
+		return err
+	}
+	a.opts.Codec = codec
+	a.seg.dict = dict
+	if a.opts.EntryCodec != CodecNone {
+		// Zstd contains parameters of files compressed separately
+	} else if codec != CodecZstd {
+		a.opts.Zstd = nil
+	} else if a.opts.Zstd == nil {
+		a.opts.Zstd, _ = ParseZstdOptions("")
+	}
+
+	if codec == CodecNone {
+		// uncompressed archive is checked by offsets of files, dictionary before it is not encrypted
+		if _, err := OpenReaderAt(a.f, info.Size(), Options{Key: a.opts.Key}); err != nil {
+			return err
+		}
+		a.seg.offset = uint64(info.Size() - dictFrameSize(dict))
+		return nil
+	}
+	ft, segments, err := readFileTables(ctx, io.NewSectionReader(a.f, 0, info.Size()), Options{Codec: codec, Key: a.opts.Key, WriteSpeed: a.opts.WriteSpeed})
+	if err != nil {
+		return err
+	}
+	for _, n := range segments {
+		a.seg.offset += ft[:n].archiveSize()
+		ft = ft[n:]
+	}
+	return nil
+}
+
+// Pack appends files of ft to archive, like Pack.
+// After an error incomplete segment is truncated; if truncation fails, next calls return its error.
+func (a *Appender) Pack(ctx context.Context, ft FileTable) error {
+	if a.err != nil {
+		return a.err
+	}
+	seg := a.seg
+	if err := pack(ctx, a.f, ft, a.opts, &a.seg); err != nil {
+		a.seg = seg
+		if e := a.f.Truncate(a.size); e != nil {
+			a.err = fmt.Errorf("cannot truncate incomplete segment: %w", e)
+		} else if _, e := a.f.Seek(a.size, io.SeekStart); e != nil {
+			a.err = e
+		}
+		return err
+	}
+	a.size, a.err = a.f.Seek(0, io.SeekCurrent)
+	return a.err
+}
+
+// PackDir appends files found in root, like PackDir
+func (a *Appender) PackDir(ctx context.Context, root string) (err error) {
+	if a.err != nil {
+		return a.err
+	}
+	var sp spooler
+	defer func() {
+		if e := sp.Close(); e != nil && err == nil {
+			err = e
+		}
+	}()
+	ft, err := findFileTable(ctx, root, &a.opts, &sp)
+	if err != nil {
+		return err
+	}
+	for _, it := range a.opts.Sources {
+		ft = append(ft, File{Name: it.Name})
+		if err := sp.spool(ctx, &ft[len(ft)-1], it.Reader); err != nil {
+			return err
+		}
+	}
+	return a.Pack(ctx, ft)
+}
+
+// Close closes file of archive
+func (a *Appender) Close() error {
+	return a.f.Close()
+}
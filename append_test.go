@@ -0,0 +1,127 @@
+package rawpack
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"maps"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// moreFiles are appended to archive of testFiles
+var moreFiles = map[string]string{
+	"more/e.txt": "epsilon",
+	"f.log":      "log line\nlog line\n",
+}
+
+// packTestArchive packs testFiles to archive file with opts and returns its path
+func packTestArchive(t *testing.T, opts Options) string {
+	t.Helper()
+	p := filepath.Join(t.TempDir(), "a.rpk")
+	f, err := os.Create(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := t.TempDir()
+	writeTree(t, root, testFiles)
+	err = PackDir(context.Background(), f, root, opts)
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+// checkArchive extracts archive file p with key and checks its files
+func checkArchive(t *testing.T, p string, key *Key, files map[string]string) {
+	t.Helper()
+	f, err := os.Open(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	dest := t.TempDir()
+	if err := Extract(context.Background(), f, dest, Options{Key: key}); err != nil {
+		t.Fatalf("Extract: %v", err)
+	}
+	checkTree(t, dest, files)
+}
+
+func TestAppendRoundTrip(t *testing.T) {
+	all := maps.Clone(testFiles)
+	maps.Copy(all, moreFiles)
+	forEachCodec(t, func(t *testing.T, opts Options) {
+		ctx := context.Background()
+		p := packTestArchive(t, opts)
+
+		// codec of archive is detected, it is not set for appending
+		a, err := OpenAppend(ctx, p, Options{Key: opts.Key, EntryCodec: opts.EntryCodec})
+		if err != nil {
+			t.Fatalf("OpenAppend: %v", err)
+		}
+		root := t.TempDir()
+		writeTree(t, root, moreFiles)
+		if err := a.PackDir(ctx, root); err != nil {
+			t.Fatalf("PackDir: %v", err)
+		}
+		if err := a.Close(); err != nil {
+			t.Fatal(err)
+		}
+		checkArchive(t, p, opts.Key, all)
+	})
+}
+
+func TestAppendCancel(t *testing.T) {
+	all := maps.Clone(testFiles)
+	maps.Copy(all, moreFiles)
+	forEachCodec(t, func(t *testing.T, opts Options) {
+		p := packTestArchive(t, opts)
+		before, err := os.ReadFile(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// f.log is the first appended file, appending is canceled while it is written
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		a, err := OpenAppend(ctx, p, Options{Key: opts.Key, EntryCodec: opts.EntryCodec, BufferSize: 10,
+			Progress: &cancelProgress{name: "f.log", cancel: cancel}})
+		if err != nil {
+			t.Fatalf("OpenAppend: %v", err)
+		}
+		defer a.Close()
+		root := t.TempDir()
+		writeTree(t, root, moreFiles)
+		if err := a.PackDir(ctx, root); !errors.Is(err, context.Canceled) {
+			t.Fatalf("PackDir: %v, want context.Canceled", err)
+		}
+		after, err := os.ReadFile(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(after, before) {
+			t.Errorf("archive of %d bytes is changed to %d bytes", len(before), len(after))
+		}
+		checkArchive(t, p, opts.Key, testFiles)
+
+		// the same appender continues archive
+		if err := a.PackDir(context.Background(), root); err != nil {
+			t.Fatalf("PackDir after cancellation: %v", err)
+		}
+		checkArchive(t, p, opts.Key, all)
+	})
+}
+
+func TestAppendFlate(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "a.rpk")
+	if err := os.WriteFile(p, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenAppend(context.Background(), p, Options{Codec: CodecFlate}); !errors.Is(err, ErrUnsupportedCodec) {
+		t.Errorf("OpenAppend with flate: %v, want ErrUnsupportedCodec", err)
+	}
+}
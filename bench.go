@@ -0,0 +1,196 @@
+package rawpack
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"runtime"
+	"sync"
+	"time"
+)
+
+const benchChunkSize = 1 << 20 // 1MB
+
+// BenchResult describes compression of sample by Bench
+type BenchResult struct {
+	Size           uint64
+	CompressedSize uint64
+	CompressTime   time.Duration
+	DecompressTime time.Duration
+	// PeakMemory is approximate peak of heap memory used by compression or decompression
+	PeakMemory uint64
+}
+
+// Ratio returns ratio of size of sample to size of compressed sample
+func (r *BenchResult) Ratio() float64 {
+	if r.CompressedSize == 0 {
+		return 0
+	}
+	return float64(r.Size) / float64(r.CompressedSize)
+}
+
+// CompressSpeed returns speed of compression in bytes of sample per second
+func (r *BenchResult) CompressSpeed() float64 {
+	return float64(r.Size) / r.CompressTime.Seconds()
+}
+
+// DecompressSpeed returns speed of decompression in bytes of sample per second
+func (r *BenchResult) DecompressSpeed() float64 {
+	return float64(r.Size) / r.DecompressTime.Seconds()
+}
+
+// SampleArchive packs files found like by PackDir into uncompressed archive in memory,
+// files are added, until their size reaches limit, the last file may be truncated.
+// Extensions of files are not stored, options of compression and encryption are ignored.
+func SampleArchive(ctx context.Context, root string, opts Options, limit uint64) ([]byte, error) {
+	var sp spooler
+	defer sp.Close()
+	ft, err := findFileTable(ctx, root, &opts, &sp)
+	if err != nil {
+		return nil, err
+	}
+	size := uint64(0)
+	for i := range ft {
+		if size >= limit {
+			ft = ft[:i]
+			break
+		}
+		// only stored data of file is read with truncated size
+		ft[i].Size = min(ft[i].Size, limit-size)
+		ft[i].Extensions = nil
+		size += ft[i].Size
+	}
+	if size == 0 {
+		return nil, errors.New("no data to sample")
+	}
+	var buf bytes.Buffer
+	err = Pack(ctx, &buf, ft, Options{Jobs: opts.Jobs, ReadAhead: opts.ReadAhead})
+	return buf.Bytes(), err
+}
+
+// memoryPeak polls heap memory in use, until it is stopped
+type memoryPeak struct {
+	base uint64
+	peak uint64
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+func startMemoryPeak() *memoryPeak {
+	runtime.GC()
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	m := &memoryPeak{base: ms.HeapInuse, stop: make(chan struct{})}
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		t := time.NewTicker(10 * time.Millisecond)
+		defer t.Stop()
+		for {
+			m.poll()
+			select {
+			case <-t.C:
+			case <-m.stop:
+				return
+			}
+		}
+	}()
+	return m
+}
+
+func (m *memoryPeak) poll() {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	if ms.HeapInuse > m.base {
+		m.peak = max(m.peak, ms.HeapInuse-m.base)
+	}
+}
+
+func (m *memoryPeak) done() uint64 {
+	close(m.stop)
+	m.wg.Wait()
+	m.poll()
+	return m.peak
+}
+
+// Bench compresses sample by codec of opts (Zstd, or Codec if Zstd is nil) like Pack,
+// and decompresses it like OpenReader with detection of parameters.
+// Decompressed data is compared with sample.
+func Bench(ctx context.Context, sample []byte, opts Options) (res BenchResult, err error) {
+	res.Size = uint64(len(sample))
+	if opts.ZstdDict != nil && opts.codec() != CodecZstd {
+		return res, errors.New("ZSTD dictionary requires ZSTD compression")
+	}
+	var compressed bytes.Buffer
+	compressed.Grow(len(sample))
+
+	mp := startMemoryPeak()
+	start := time.Now()
+	err = func() (err error) {
+		if opts.ZstdDict != nil {
+			if err := writeDictFrame(&compressed, opts.ZstdDict); err != nil {
+				return err
+			}
+		}
+		w, c, err := opts.wrapWriter(&compressed, res.Size, opts.ZstdDict)
+		if err != nil {
+			return err
+		}
+		if c != nil {
+			defer closeOnReturn(c, &err)
+		}
+		for b := sample; len(b) > 0; b = b[min(len(b), benchChunkSize):] {
+			if err := checkContext(ctx, ""); err != nil {
+				return err
+			}
+			if _, err := w.Write(b[:min(len(b), benchChunkSize)]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}()
+	res.CompressTime = time.Since(start)
+	res.PeakMemory = mp.done()
+	if err != nil {
+		return res, err
+	}
+	res.CompressedSize = uint64(compressed.Len())
+
+	read := Options{Codec: opts.codec(), WriteSpeed: opts.WriteSpeed}
+	mp = startMemoryPeak()
+	start = time.Now()
+	err = func() (err error) {
+		r, c, _, err := read.wrapReader(bytes.NewReader(compressed.Bytes()))
+		if err != nil {
+			return err
+		}
+		if c != nil {
+			defer closeOnReturn(c, &err)
+		}
+		buf := make([]byte, benchChunkSize)
+		rest := sample
+		for {
+			if err := checkContext(ctx, ""); err != nil {
+				return err
+			}
+			n, err := r.Read(buf)
+			if n > len(rest) || !bytes.Equal(buf[:n], rest[:n]) {
+				return errors.New("decompressed data differs from sample")
+			}
+			rest = rest[n:]
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				return err
+			}
+		}
+		if len(rest) > 0 {
+			return errors.New("decompressed data is truncated")
+		}
+		return nil
+	}()
+	res.DecompressTime = time.Since(start)
+	res.PeakMemory = max(res.PeakMemory, mp.done())
+	return res, err
+}
@@ -0,0 +1,93 @@
+package rawpack
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestSampleArchive(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	writeTree(t, root, testFiles)
+	total := uint64(0)
+	for _, it := range testFiles {
+		total += uint64(len(it))
+	}
+	for _, limit := range []uint64{1, 100, total - 1, total, total * 2} {
+		sample, err := SampleArchive(ctx, root, Options{}, limit)
+		if err != nil {
+			t.Fatalf("limit %d: %v", limit, err)
+		}
+		ra, err := NewReaderAt(bytes.NewReader(sample), int64(len(sample)))
+		if err != nil {
+			t.Fatalf("limit %d: %v", limit, err)
+		}
+		size := uint64(0)
+		for i, it := range ra.FileTable() {
+			content, err := io.ReadAll(ra.Open(i))
+			if err != nil {
+				t.Fatal(err)
+			}
+			// the last file may be truncated
+			if !strings.HasPrefix(testFiles[it.Name], string(content)) {
+				t.Errorf("limit %d: content of %s differs", limit, it.Name)
+			}
+			size += it.Size
+		}
+		if size != min(limit, total) {
+			t.Errorf("limit %d: sample has %d bytes of files", limit, size)
+		}
+	}
+	if _, err := SampleArchive(ctx, t.TempDir(), Options{}, 100); err == nil {
+		t.Error("SampleArchive of empty directory succeeded")
+	}
+}
+
+func TestBench(t *testing.T) {
+	ctx := context.Background()
+	sample := bytes.Repeat([]byte("benchmark sample line\n"), 20000)
+	zstd, err := ParseZstdOptions("l=low,t=2,m=1M")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]Options{
+		"zstd":   {Zstd: zstd},
+		"gzip":   {Codec: CodecGzip},
+		"s2":     {Codec: CodecS2},
+		"snappy": {Codec: CodecSnappy},
+		"flate":  {Codec: CodecFlate},
+	}
+	for name, opts := range tests {
+		res, err := Bench(ctx, sample, opts)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if res.Size != uint64(len(sample)) || res.CompressedSize == 0 || res.Ratio() <= 1 {
+			t.Errorf("%s: size %d, compressed size %d", name, res.Size, res.CompressedSize)
+		}
+		if res.CompressTime <= 0 || res.DecompressTime <= 0 || res.CompressSpeed() <= 0 || res.DecompressSpeed() <= 0 {
+			t.Errorf("%s: times %v, %v", name, res.CompressTime, res.DecompressTime)
+		}
+	}
+
+	if _, err := Bench(ctx, sample, Options{Codec: CodecGzip, ZstdDict: zstdDictMagic}); err == nil {
+		t.Error("Bench of gzip with ZSTD dictionary succeeded")
+	}
+	if _, err := Bench(ctx, sample, Options{Codec: CodecXz}); !errors.Is(err, ErrUnsupportedCodec) {
+		t.Errorf("Bench of xz: %v, want ErrUnsupportedCodec", err)
+	}
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	var ce *CancelError
+	if _, err := Bench(canceled, sample, Options{Codec: CodecGzip}); !errors.As(err, &ce) {
+		t.Errorf("Bench with canceled context: %v, want *CancelError", err)
+	}
+	var empty BenchResult
+	if empty.Ratio() != 0 {
+		t.Errorf("Ratio of empty result = %v", empty.Ratio())
+	}
+}
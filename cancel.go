@@ -0,0 +1,47 @@
+package rawpack
+
+import (
+	"context"
+	"fmt"
+	"io"
+)
+
+// CancelError is returned, when packing or extraction is interrupted by cancellation of context,
+// it wraps context.Canceled or context.DeadlineExceeded
+type CancelError struct {
+	// File is name of file being processed at cancellation, it is empty between files
+	File string
+	Err  error
+}
+
+func (e *CancelError) Error() string {
+	if len(e.File) == 0 {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("%v (processing %q)", e.Err, e.File)
+}
+
+func (e *CancelError) Unwrap() error {
+	return e.Err
+}
+
+func checkContext(ctx context.Context, name string) error {
+	if err := ctx.Err(); err != nil {
+		return &CancelError{File: name, Err: err}
+	}
+	return nil
+}
+
+// contextReader fails reading after cancellation of context
+type contextReader struct {
+	ctx  context.Context
+	name string
+	r    io.Reader
+}
+
+func (r *contextReader) Read(b []byte) (int, error) {
+	if err := checkContext(r.ctx, r.name); err != nil {
+		return 0, err
+	}
+	return r.r.Read(b)
+}
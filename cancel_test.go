@@ -0,0 +1,112 @@
+package rawpack
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// cancelProgress cancels context, when file name is being copied
+type cancelProgress struct {
+	name   string
+	cancel context.CancelFunc
+}
+
+func (p *cancelProgress) Start(ft FileTable)          {}
+func (p *cancelProgress) FileStart(f *File)           {}
+func (p *cancelProgress) FileDone(f *File, err error) {}
+
+func (p *cancelProgress) FileProgress(f *File, n uint64) {
+	if f.Name == p.name {
+		p.cancel()
+	}
+}
+
+// checkCancelError checks, that err is *CancelError of file name wrapping context.Canceled
+func checkCancelError(t *testing.T, err error, name string) {
+	t.Helper()
+	var ce *CancelError
+	if !errors.As(err, &ce) || !errors.Is(err, context.Canceled) {
+		t.Fatalf("got %v, want CancelError wrapping context.Canceled", err)
+	}
+	if ce.File != name {
+		t.Errorf("CancelError of file %q, want %q", ce.File, name)
+	}
+}
+
+func TestPackCancel(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, testFiles)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var buf bytes.Buffer
+	err := PackDir(ctx, &buf, root, Options{Progress: &cancelProgress{name: "b.log", cancel: cancel}, BufferSize: 100})
+	checkCancelError(t, err, "b.log")
+}
+
+// cancelReader cancels context after the first read
+type cancelReader struct {
+	r      *strings.Reader
+	cancel context.CancelFunc
+}
+
+func (r *cancelReader) Read(b []byte) (int, error) {
+	n, err := r.r.Read(b[:min(len(b), 10)])
+	r.cancel()
+	return n, err
+}
+
+func TestPackCancelSpooled(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sources := []Source{
+		{Name: "spooled", Reader: strings.NewReader(strings.Repeat("x", 10000))},
+		{Name: "canceled", Reader: &cancelReader{r: strings.NewReader(strings.Repeat("y", 10000)), cancel: cancel}},
+	}
+	var buf bytes.Buffer
+	err := PackDir(ctx, &buf, "", Options{Sources: sources})
+	checkCancelError(t, err, "canceled")
+	if buf.Len() != 0 {
+		t.Errorf("%d bytes are written", buf.Len())
+	}
+	// spooled files are removed
+	if entries, err := os.ReadDir(tmp); err != nil || len(entries) != 0 {
+		t.Errorf("temporary directory contains %d files: %v", len(entries), err)
+	}
+}
+
+func TestExtractCancel(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, testFiles)
+	var buf bytes.Buffer
+	if err := PackDir(context.Background(), &buf, root, Options{}); err != nil {
+		t.Fatal(err)
+	}
+	for _, jobs := range []int{1, 4} {
+		ctx, cancel := context.WithCancel(context.Background())
+		dest := t.TempDir()
+		opts := Options{Progress: &cancelProgress{name: "b.log", cancel: cancel}, BufferSize: 100, Jobs: jobs}
+		err := Extract(ctx, bytes.NewReader(buf.Bytes()), dest, opts)
+		cancel()
+		if jobs == 1 {
+			checkCancelError(t, err, "b.log")
+		} else if !errors.Is(err, context.Canceled) {
+			t.Fatalf("jobs %d: got %v, want context.Canceled", jobs, err)
+		}
+		// incomplete file is removed, files before it are kept
+		if _, err := os.Stat(filepath.Join(dest, "b.log")); !os.IsNotExist(err) {
+			t.Errorf("jobs %d: incomplete file is not removed: %v", jobs, err)
+		}
+		if jobs == 1 {
+			if _, err := os.Stat(filepath.Join(dest, "a.txt")); err != nil {
+				t.Errorf("file extracted before cancellation: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/egor9814/rawpack"
+)
+
+const (
+	defaultBenchSample = 32 << 20  // 32MB
+	defaultMinSpeed    = 100 << 20 // 100MB/s
+)
+
+var (
+	defaultBenchLevels  = []string{"low", "mid", "high", "best"}
+	defaultBenchWindows = []string{"1M", "8M", "64M"}
+)
+
+// benchParams are lists of parameters to benchmark, every ZSTD combination of them is measured
+type benchParams struct {
+	codecs  []string
+	levels  []string
+	threads []string
+	windows []string
+}
+
+type benchEntry struct {
+	Codec string `json:"codec"`
+	// Options is value of --zstd= for ZSTD
+	Options         string  `json:"options,omitempty"`
+	Ratio           float64 `json:"ratio"`
+	CompressSpeed   float64 `json:"compress_speed"`
+	DecompressSpeed float64 `json:"decompress_speed"`
+	PeakMemory      uint64  `json:"peak_memory"`
+}
+
+// splitList splits comma-separated values of repeated flag
+func splitList(list, def []string) []string {
+	if len(list) == 0 {
+		return def
+	}
+	var res []string
+	for _, it := range list {
+		res = append(res, strings.Split(it, ",")...)
+	}
+	return res
+}
+
+// options returns options of codecs to benchmark, with values of --zstd= for ZSTD
+func (p *benchParams) options() ([]rawpack.Options, []string, error) {
+	threads := []string{"1"}
+	if n := runtime.NumCPU(); n > 1 {
+		threads = append(threads, strconv.Itoa(n))
+	}
+	var opts []rawpack.Options
+	var labels []string
+	for _, name := range splitList(p.codecs, []string{"zstd", "gzip", "s2", "snappy", "flate"}) {
+		codec, err := rawpack.ParseCodec(name)
+		if err != nil {
+			return nil, nil, newUsageError("%v", err)
+		}
+		if codec == rawpack.CodecNone || codec == rawpack.CodecXz {
+			return nil, nil, newUsageError("codec %q cannot be benchmarked", name)
+		}
+		if codec != rawpack.CodecZstd {
+			opts = append(opts, rawpack.Options{Codec: codec})
+			labels = append(labels, "")
+			continue
+		}
+		for _, l := range splitList(p.levels, defaultBenchLevels) {
+			for _, t := range splitList(p.threads, threads) {
+				for _, m := range splitList(p.windows, defaultBenchWindows) {
+					s := fmt.Sprintf("l=%s,t=%s,m=%s", l, t, m)
+					z, err := rawpack.ParseZstdOptions(s)
+					if err != nil {
+						return nil, nil, newUsageError("invalid parameters %q: %v", s, err)
+					}
+					opts = append(opts, rawpack.Options{Zstd: z})
+					labels = append(labels, s)
+				}
+			}
+		}
+	}
+	return opts, labels, nil
+}
+
+// recommend returns ZSTD entry with the best ratio, which is compressed at least with minSpeed,
+// or the fastest one
+func recommend(entries []benchEntry, minSpeed float64) *benchEntry {
+	var best, fastest *benchEntry
+	for i := range entries {
+		it := &entries[i]
+		if it.Codec != "zstd" {
+			continue
+		}
+		if fastest == nil || it.CompressSpeed > fastest.CompressSpeed {
+			fastest = it
+		}
+		if it.CompressSpeed < minSpeed {
+			continue
+		}
+		if best == nil || it.Ratio > best.Ratio || (it.Ratio == best.Ratio && it.PeakMemory < best.PeakMemory) {
+			best = it
+		}
+	}
+	if best == nil {
+		return fastest
+	}
+	return best
+}
+
+func benchArchive(ctx context.Context, root string, opts rawpack.Options, p benchParams, sampleSize, minSpeed uint64, format listFormat, verbose bool) error {
+	candidates, labels, err := p.options()
+	if err != nil {
+		return err
+	}
+	if verbose {
+		logf("sampling %s from %q...\n", formatBytes(float64(sampleSize)), root)
+	}
+	sample, err := rawpack.SampleArchive(ctx, root, opts, sampleSize)
+	if err != nil {
+		return err
+	}
+	if verbose {
+		logf("sample of %s\n", formatBytes(float64(len(sample))))
+	}
+
+	entries := make([]benchEntry, 0, len(candidates))
+	for i, it := range candidates {
+		e := benchEntry{Codec: it.Codec.String(), Options: labels[i]}
+		if it.Zstd != nil {
+			e.Codec = "zstd"
+		}
+		name := strings.TrimSpace(e.Codec + " " + e.Options)
+		if verbose {
+			logf("%3d/%3d> %s\n", i+1, len(candidates), name)
+		}
+		it.WriteSpeed = opts.WriteSpeed
+		it.Jobs = opts.Jobs
+		res, err := rawpack.Bench(ctx, sample, it)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		e.Ratio = res.Ratio()
+		e.CompressSpeed = res.CompressSpeed()
+		e.DecompressSpeed = res.DecompressSpeed()
+		e.PeakMemory = res.PeakMemory
+		entries = append(entries, e)
+	}
+	rec := recommend(entries, float64(minSpeed))
+	return writeBench(entries, rec, format)
+}
+
+func writeBench(entries []benchEntry, rec *benchEntry, format listFormat) error {
+	out := os.Stdout
+	switch format {
+	case jsonFormat:
+		res := struct {
+			Results     []benchEntry `json:"results"`
+			Recommended string       `json:"recommended,omitempty"`
+		}{Results: entries}
+		if rec != nil {
+			res.Recommended = rec.Options
+		}
+		e := json.NewEncoder(out)
+		e.SetIndent("", "  ")
+		return e.Encode(res)
+
+	case jsonlFormat:
+		e := json.NewEncoder(out)
+		for _, it := range entries {
+			if err := e.Encode(it); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case csvFormat:
+		w := csv.NewWriter(out)
+		_ = w.Write([]string{"codec", "options", "ratio", "compress_speed", "decompress_speed", "peak_memory"})
+		for _, it := range entries {
+			_ = w.Write([]string{
+				it.Codec,
+				it.Options,
+				strconv.FormatFloat(it.Ratio, 'f', 3, 64),
+				strconv.FormatFloat(it.CompressSpeed, 'f', 0, 64),
+				strconv.FormatFloat(it.DecompressSpeed, 'f', 0, 64),
+				strconv.FormatUint(it.PeakMemory, 10),
+			})
+		}
+		w.Flush()
+		return w.Error()
+
+	default:
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		_, _ = fmt.Fprintln(w, "codec\toptions\tratio\tcompress\tdecompress\tmemory")
+		for _, it := range entries {
+			_, _ = fmt.Fprintf(w, "%s\t%s\t%.3f\t%s/s\t%s/s\t%s\n", it.Codec, it.Options, it.Ratio,
+				formatBytes(it.CompressSpeed), formatBytes(it.DecompressSpeed), formatBytes(float64(it.PeakMemory)))
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		if rec != nil {
+			// the best parameters are printed last, so they are easy to copy
+			_, _ = fmt.Fprintf(out, "\nrecommended: --zstd=%s\n", rec.Options)
+		}
+		return nil
+	}
+}
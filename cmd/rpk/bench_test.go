@@ -0,0 +1,85 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/egor9814/rawpack"
+)
+
+func TestBenchOptions(t *testing.T) {
+	p := benchParams{
+		codecs:  []string{"gzip,zstd", "s2"},
+		levels:  []string{"low,best"},
+		threads: []string{"1"},
+		windows: []string{"1M", "8M"},
+	}
+	opts, labels, err := p.options()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"", "l=low,t=1,m=1M", "l=low,t=1,m=8M", "l=best,t=1,m=1M", "l=best,t=1,m=8M", ""}
+	if !slices.Equal(labels, want) {
+		t.Errorf("labels = %q, want %q", labels, want)
+	}
+	if len(opts) != len(want) || opts[0].Codec != rawpack.CodecGzip || opts[1].Zstd == nil || opts[5].Codec != rawpack.CodecS2 {
+		t.Errorf("options = %+v", opts)
+	}
+
+	// all codecs except ZSTD are measured once by default
+	opts, _, err = (&benchParams{}).options()
+	if err != nil {
+		t.Fatal(err)
+	}
+	zstd := 0
+	for _, it := range opts {
+		if it.Zstd != nil {
+			zstd++
+		}
+	}
+	if len(opts)-zstd != 4 || zstd%(len(defaultBenchLevels)*len(defaultBenchWindows)) != 0 {
+		t.Errorf("default options: %d of ZSTD, %d total", zstd, len(opts))
+	}
+
+	for _, it := range []benchParams{
+		{codecs: []string{"lz4"}},
+		{codecs: []string{"none"}},
+		{codecs: []string{"xz"}},
+		{codecs: []string{"zstd"}, levels: []string{"fast"}},
+	} {
+		var ue usageError
+		if _, _, err := it.options(); !errors.As(err, &ue) {
+			t.Errorf("%+v: %v, want usage error", it, err)
+		}
+	}
+}
+
+func TestRecommend(t *testing.T) {
+	entries := []benchEntry{
+		{Codec: "gzip", Ratio: 10, CompressSpeed: 1000},
+		{Codec: "zstd", Options: "fast", Ratio: 2, CompressSpeed: 500},
+		{Codec: "zstd", Options: "good", Ratio: 4, CompressSpeed: 200, PeakMemory: 20},
+		{Codec: "zstd", Options: "good small", Ratio: 4, CompressSpeed: 150, PeakMemory: 10},
+		{Codec: "zstd", Options: "slow", Ratio: 8, CompressSpeed: 50},
+	}
+	tests := []struct {
+		minSpeed float64
+		want     string
+	}{
+		{0, "slow"},
+		{100, "good small"},
+		{160, "good"},
+		{300, "fast"},
+		// the fastest is recommended, if all are slow
+		{1000, "fast"},
+	}
+	for _, tt := range tests {
+		if got := recommend(entries, tt.minSpeed); got == nil || got.Options != tt.want {
+			t.Errorf("recommend(%v) = %+v, want %q", tt.minSpeed, got, tt.want)
+		}
+	}
+	if got := recommend(entries[:1], 0); got != nil {
+		t.Errorf("recommend without ZSTD = %+v", got)
+	}
+}
@@ -1,64 +1,181 @@
 package main
 
 import (
-	"fmt"
-	"math/rand"
+	"encoding/json"
+	"errors"
+	"io/fs"
 	"os"
+	"path/filepath"
+	"strconv"
 	"time"
 )
 
-func makeIOBuffer() (buf []byte, writeSpeed float64, err error) {
-	impl := func(buf []byte) (writeSpeed float64, err error) {
-		var f *os.File
-		f, err = os.Create(fmt.Sprintf(".%d-%d.tmp", rand.Uint64(), rand.Uint64()))
-		if err != nil {
-			return
+const (
+	// defaultWriteSpeed is used, when speed of storage is not measured (buffers per second)
+	defaultWriteSpeed = 100
+	// ioCacheTTL is time, after which parameters of device are measured again
+	ioCacheTTL  = 30 * 24 * time.Hour
+	ioCacheName = "io.json"
+)
+
+// ioParams are measured parameters of storage device
+type ioParams struct {
+	BufferSize int       `json:"buffer_size"`
+	WriteSpeed float64   `json:"write_speed"`
+	Measured   time.Time `json:"measured"`
+}
+
+// ioCache stores parameters of devices by their IDs in $XDG_CACHE_HOME/rpk
+type ioCache map[string]ioParams
+
+func ioCachePath() (string, error) {
+	dir := os.Getenv("XDG_CACHE_HOME")
+	if len(dir) == 0 {
+		var err error
+		if dir, err = os.UserCacheDir(); err != nil {
+			return "", err
 		}
-		defer func(name string) {
-			err := os.Remove(name)
-			if err != nil {
-				logf("warning: cannot remove temporary file %q\n", name)
-			}
-		}(f.Name())
-		defer handleClosing(f, f.Name())
+	}
+	return filepath.Join(dir, "rpk", ioCacheName), nil
+}
 
-		start := time.Now()
-		_, err = f.Write(buf)
-		if err != nil {
-			return
+func loadIOCache() ioCache {
+	c := ioCache{}
+	p, err := ioCachePath()
+	if err != nil {
+		return c
+	}
+	if b, err := os.ReadFile(p); err == nil {
+		// broken cache is measured again
+		_ = json.Unmarshal(b, &c)
+	}
+	return c
+}
+
+// save writes cache atomically, so concurrent runs don't read partial file
+func (c ioCache) save() error {
+	p, err := ioCachePath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(p), ioCacheName+".*")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(b)
+	if e := tmp.Close(); err == nil {
+		err = e
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), p)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// existingDir returns dir or its nearest existing parent, which is on the same device usually
+func existingDir(dir string) string {
+	dir, _ = filepath.Abs(dir)
+	for {
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			return dir
 		}
-		err = f.Sync()
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return dir
+		}
+		dir = parent
+	}
+}
+
+// tuneIO returns size of I/O buffer and write speed of storage, where files are written to dir.
+// Parameters are measured once per device and cached. bufferSize overrides measured size, if it is not 0.
+// Defaults are returned, if dir is empty (stdout) or cannot be measured.
+func tuneIO(dir string, bufferSize uint64) (int, float64) {
+	params := ioParams{BufferSize: int(bufferSize), WriteSpeed: defaultWriteSpeed}
+	if len(dir) == 0 {
+		return params.BufferSize, params.WriteSpeed
+	}
+	dir = existingDir(dir)
+	id, ok := deviceID(dir)
+	if !ok {
+		return params.BufferSize, params.WriteSpeed
+	}
+	key := strconv.FormatUint(id, 10)
+	cache := loadIOCache()
+	if p, ok := cache[key]; ok && time.Since(p.Measured) < ioCacheTTL {
+		params = p
+	} else if bufferSize == 0 {
+		p, err := measureIO(dir)
 		if err != nil {
-			return
+			// read-only or full storage is not tuned
+			return params.BufferSize, params.WriteSpeed
 		}
-		elapsed := time.Since(start)
+		cache[key] = p
+		_ = cache.save()
+		params = p
+	}
+	if bufferSize != 0 {
+		params.BufferSize = int(bufferSize)
+	}
+	return params.BufferSize, params.WriteSpeed
+}
 
-		writeSpeed = 1.0 / elapsed.Seconds()
+// measureIO finds size of buffer with the best speed of synced writes to temporary file in dir
+func measureIO(dir string) (ioParams, error) {
+	f, err := os.CreateTemp(dir, ".rpk-*.tmp")
+	if err != nil {
+		return ioParams{}, err
+	}
+	// file is unlinked while it is open, so nothing is left, if process is killed
+	removed := os.Remove(f.Name()) == nil
+	defer func() {
+		_ = f.Close()
+		if !removed {
+			if err := os.Remove(f.Name()); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				logf("warning: cannot remove temporary file %q\n", f.Name())
+			}
+		}
+	}()
 
-		return
+	measure := func(buf []byte) (float64, error) {
+		if err := f.Truncate(0); err != nil {
+			return 0, err
+		}
+		if _, err := f.Seek(0, 0); err != nil {
+			return 0, err
+		}
+		start := time.Now()
+		if _, err := f.Write(buf); err != nil {
+			return 0, err
+		}
+		if err := f.Sync(); err != nil {
+			return 0, err
+		}
+		return 1.0 / time.Since(start).Seconds(), nil
 	}
 
 	initialSize := 2 << 20 // 2MB
-	bestSpeed := 0.0
-	bestSize := 0
-
-	buf = make([]byte, initialSize)
-
+	best := ioParams{Measured: time.Now()}
+	buf := make([]byte, initialSize)
 	for size := initialSize; size > 128<<10; /* 128KB */ size >>= 1 {
-		s, e := impl(buf[:size])
-		if e != nil {
-			return nil, 0, e
+		s, err := measure(buf[:size])
+		if err != nil {
+			return ioParams{}, err
 		}
-		if s > bestSpeed {
-			bestSpeed = s
-			bestSize = size
+		if s > best.WriteSpeed {
+			best.WriteSpeed = s
+			best.BufferSize = size
 		}
 	}
-
-	if len(buf) != bestSize {
-		buf = make([]byte, bestSize)
-	}
-	writeSpeed = bestSpeed
-
-	return
+	return best, nil
 }
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestExistingDir(t *testing.T) {
+	dir := t.TempDir()
+	if got := existingDir(filepath.Join(dir, "missing", "sub")); got != dir {
+		t.Errorf("existingDir of missing directory = %q, want %q", got, dir)
+	}
+	if got := existingDir(dir); got != dir {
+		t.Errorf("existingDir = %q, want %q", got, dir)
+	}
+}
+
+func TestTuneIO(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	if size, speed := tuneIO("", 0); size != 0 || speed != defaultWriteSpeed {
+		t.Errorf("tuneIO of stdout = %d, %v", size, speed)
+	}
+	if _, err := os.Stat(mustCachePath(t)); err == nil {
+		t.Error("cache is written for stdout")
+	}
+
+	dir := t.TempDir()
+	id, ok := deviceID(dir)
+	if !ok {
+		t.Skip("device ID is not supported")
+	}
+	key := strconv.FormatUint(id, 10)
+	cached := ioParams{BufferSize: 12345, WriteSpeed: 7, Measured: time.Now()}
+	tests := []struct {
+		name string
+		// cache is written before tuneIO, nil means no cache file
+		cache      ioCache
+		broken     bool
+		bufferSize uint64
+		// measured means, that cached parameters are not used
+		measured bool
+		wantSize int
+	}{
+		{name: "cached", cache: ioCache{key: cached}, wantSize: 12345},
+		{name: "override", cache: ioCache{key: cached}, bufferSize: 4096, wantSize: 4096},
+		{name: "other device", cache: ioCache{key + "0": cached}, measured: true},
+		{name: "expired", cache: ioCache{key: {BufferSize: 12345, WriteSpeed: 7, Measured: time.Now().Add(-ioCacheTTL)}}, measured: true},
+		{name: "broken", broken: true, measured: true},
+		{name: "missing", measured: true},
+	}
+	for _, tt := range tests {
+		p := mustCachePath(t)
+		_ = os.Remove(p)
+		if tt.cache != nil {
+			if err := tt.cache.save(); err != nil {
+				t.Fatal(err)
+			}
+		} else if tt.broken {
+			if err := os.WriteFile(p, []byte("{broken"), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		size, speed := tuneIO(filepath.Join(dir, "missing"), tt.bufferSize)
+		if !tt.measured {
+			if size != tt.wantSize || speed != cached.WriteSpeed {
+				t.Errorf("%s: tuneIO = %d, %v, want %d, %v", tt.name, size, speed, tt.wantSize, cached.WriteSpeed)
+			}
+			continue
+		}
+		// measured size is power of 2 in 256KB..2MB
+		if size < 256<<10 || size > 2<<20 || size&(size-1) != 0 || speed <= 0 {
+			t.Errorf("%s: measured parameters %d, %v", tt.name, size, speed)
+		}
+		c := loadIOCache()
+		if got, ok := c[key]; !ok || got.BufferSize != size || got.WriteSpeed != speed {
+			t.Errorf("%s: measured parameters are not cached: %v", tt.name, c)
+		}
+		for k := range tt.cache {
+			if _, ok := c[k]; !ok {
+				t.Errorf("%s: parameters of device %s are lost", tt.name, k)
+			}
+		}
+	}
+	// temporary files are removed
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("files are left in measured directory: %v", entries)
+	}
+}
+
+func mustCachePath(t *testing.T) string {
+	t.Helper()
+	p, err := ioCachePath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/egor9814/rawpack"
+)
+
+const catBufferSize = 256 << 10 // 256KB
+
+// parseSeparator replaces escapes \n, \t, \r, \0, \\, \" and \xNN in s, other characters are kept as is
+func parseSeparator(s string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			b.WriteByte(s[i])
+			continue
+		}
+		if i+1 == len(s) {
+			return "", errors.New("trailing '\\', use '\\\\' for backslash")
+		}
+		i++
+		switch s[i] {
+		case 'n':
+			b.WriteByte('\n')
+		case 't':
+			b.WriteByte('\t')
+		case 'r':
+			b.WriteByte('\r')
+		case '0':
+			b.WriteByte(0)
+		case '\\', '"':
+			b.WriteByte(s[i])
+		case 'x':
+			if i+2 >= len(s) {
+				return "", fmt.Errorf("incomplete escape %q", s[i-1:])
+			}
+			v, err := strconv.ParseUint(s[i+1:i+3], 16, 8)
+			if err != nil {
+				return "", fmt.Errorf("invalid escape %q", s[i-1:i+3])
+			}
+			b.WriteByte(byte(v))
+			i += 2
+		default:
+			return "", fmt.Errorf("unknown escape %q", s[i-1:i+1])
+		}
+	}
+	return b.String(), nil
+}
+
+func catArchive(ctx context.Context, name, separator string, opts rawpack.Options) error {
+	patterns := opts.Include
+	if len(patterns) == 0 {
+		patterns = []string{"**"}
+	}
+	matcher, err := rawpack.CompilePatterns(patterns, opts.IgnoreCase)
+	if err != nil {
+		return err
+	}
+	match := func(f *rawpack.File) bool {
+		return matcher.Match(f.Name)
+	}
+
+	buf := make([]byte, catBufferSize)
+	found := 0
+	write := func(f *rawpack.File, src io.Reader) error {
+		if found > 0 && len(separator) > 0 {
+			if _, err := io.WriteString(os.Stdout, strings.ReplaceAll(separator, "{}", f.Name)); err != nil {
+				return err
+			}
+		}
+		found++
+		content, err := rawpack.NewContentReader(&contextReader{ctx: ctx, name: f.Name, r: src}, f)
+		if err != nil {
+			return err
+		}
+		// holes of sparse file are written as zeros, compressed file is decompressed
+		cf := *f
+		cf.Size = f.ContentSize()
+		return rawpack.CopyFile(os.Stdout, content, &cf, buf, nil)
+	}
+
+	ra, c, err := openIndex(name, opts)
+	if err != nil {
+		return err
+	}
+	if ra != nil {
+		defer handleClosing(c, name)
+		ft := ra.FileTable()
+		for i := range ft {
+			if match(&ft[i]) {
+				if err := write(&ft[i], ra.Open(i)); err != nil {
+					return err
+				}
+			}
+		}
+	} else {
+		archive, ft, c, err := openArchive(name, opts)
+		if err != nil {
+			return err
+		}
+		defer handleClosing(c, name)
+		for ; err == nil; ft, err = archive.NextFileTable() {
+			for i := range ft {
+				src := &contextReader{ctx: ctx, name: ft[i].Name, r: archive.ReadFile(&ft[i])}
+				if match(&ft[i]) {
+					if err := write(&ft[i], src); err != nil {
+						return err
+					}
+				}
+				// compressed file may be read partially
+				if _, err := io.CopyBuffer(io.Discard, src, buf); err != nil {
+					return err
+				}
+			}
+		}
+		if err != io.EOF {
+			return err
+		}
+	}
+
+	if found == 0 {
+		return errors.New("no files in archive match specified patterns")
+	}
+	return nil
+}
@@ -0,0 +1,511 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/egor9814/rawpack"
+)
+
+type config struct {
+	name         string
+	dir          string
+	excludes     []string
+	excludeFrom  []string
+	filesFrom    []string
+	null         bool
+	reproducible bool
+	sparse       bool
+	xattrs       bool
+	xattrInclude []string
+	xattrExclude []string
+	dict         string
+	trainDict    bool
+	dictSize     uint64
+	output       string
+	excludeVCS   bool
+	gitignore    bool
+	ignoreCase   bool
+	password     *passwordFlags
+	zstd         *rawpack.ZstdOptions
+	codec        rawpack.Codec
+	entryCodec   rawpack.Codec
+	incompress   rawpack.IncompressibleOptions
+	stdinName    string
+	jobs         int
+	readAhead    uint64
+	bufferSize   uint64
+	appendTo     bool
+	verbose      bool
+	format       listFormat
+	separator    string
+	listen       string
+	bench        benchParams
+	sampleSize   uint64
+	minSpeed     uint64
+}
+
+func (c *config) options(ctx context.Context, patterns []string) (rawpack.Options, error) {
+	opts := rawpack.Options{
+		Include:        patterns,
+		Exclude:        c.excludes,
+		ExcludeFrom:    c.excludeFrom,
+		ExcludeVCS:     c.excludeVCS,
+		IgnoreCase:     c.ignoreCase,
+		Reproducible:   c.reproducible,
+		Sparse:         c.sparse,
+		Xattrs:         c.xattrs,
+		XattrInclude:   c.xattrInclude,
+		XattrExclude:   c.xattrExclude,
+		Zstd:           c.zstd,
+		Codec:          c.codec,
+		EntryCodec:     c.entryCodec,
+		Incompressible: c.incompress,
+		Jobs:           c.jobs,
+		ReadAhead:      c.readAhead,
+		BufferSize:     int(c.bufferSize),
+		// speed of storage is measured only for written files, see tuneIO
+		WriteSpeed: defaultWriteSpeed,
+	}
+	if c.zstd != nil && c.codec != rawpack.CodecNone && c.codec != rawpack.CodecZstd {
+		return opts, newUsageError("--zstd cannot be used with --codec=%s", c.codec)
+	}
+	if c.entryCodec != rawpack.CodecNone && (c.codec != rawpack.CodecNone || (c.zstd != nil && c.entryCodec != rawpack.CodecZstd)) {
+		return opts, newUsageError("--entry-codec cannot be used with compression of archive")
+	}
+	if len(c.dict) > 0 {
+		d, err := os.ReadFile(c.dict)
+		if err != nil {
+			return opts, err
+		}
+		if err := rawpack.ValidateZstdDict(d); err != nil {
+			return opts, fmt.Errorf("%s: %w", c.dict, err)
+		}
+		opts.ZstdDict = d
+	}
+	opts.TrainZstdDict = c.trainDict
+	opts.ZstdDictSize = int(c.dictSize)
+	if c.gitignore {
+		opts.IgnoreFiles = append(opts.IgnoreFiles, ".gitignore")
+	}
+	if c.password != nil {
+		src, err := c.password.source(ctx)
+		if err != nil {
+			return opts, err
+		}
+		if src != nil {
+			opts.Key, err = rawpack.DeriveKey(src)
+			if err != nil {
+				return opts, fmt.Errorf("password: %w", err)
+			}
+		}
+	}
+	return opts, nil
+}
+
+func (c *config) fileFlag(fs *flagSet) {
+	fs.add(stringValue{&c.name}, "f", "file", "<name>", "set archive name ('-' means stdin/stdout)")
+}
+
+func (c *config) dirFlag(fs *flagSet, help string) {
+	fs.add(stringValue{&c.dir}, "d", "dir", "<dir>", help)
+}
+
+// passwordFlag adds options of password sources, confirm enables confirmation of prompted password
+func (c *config) passwordFlag(fs *flagSet, confirm bool) {
+	p := &passwordFlags{confirm: confirm}
+	c.password = p
+	fs.add(stringValue{&p.value}, "p", "password", "<password>", "set archive password (unsafe, it is visible to other users)")
+	fs.add(stringValue{&p.file}, "", "password-file", "<file>", "read password from the first line of <file>")
+	fs.add(stringValue{&p.env}, "", "password-env", "<var>", "read password from environment variable <var>")
+	fs.add(stringValue{&p.fd}, "", "password-fd", "<n>", "read password from the first line of file descriptor <n>")
+	fs.add(boolValue{&p.prompt}, "P", "password-prompt", "", "ask password on terminal")
+}
+
+func (c *config) zstdFlag(fs *flagSet, help string) {
+	fs.add(zstdValue{&c.zstd}, "", "zstd", "[=<zstd_options>]", help)
+}
+
+func (c *config) bufferSizeFlag(fs *flagSet) {
+	fs.add(sizeValue{&c.bufferSize}, "", "buffer-size", "<size>", "set size of I/O buffer, it is measured for storage by default\n(results are cached in $XDG_CACHE_HOME/rpk)")
+}
+
+func (c *config) jobsFlag(fs *flagSet, help string) {
+	fs.add(jobsValue{&c.jobs}, "j", "jobs", "<n>", help)
+}
+
+// editFlags adds options of commands, which rewrite archive
+func (c *config) editFlags(fs *flagSet) {
+	fs.add(codecValue{&c.codec}, "", "codec", "<codec>", "read archive compressed with <codec>,\nit is detected by default, except flate")
+	c.zstdFlag(fs, "set parameters of ZSTD compression of archive")
+	c.passwordFlag(fs, false)
+	c.bufferSizeFlag(fs)
+}
+
+func (c *config) ignoreCaseFlag(fs *flagSet) {
+	fs.add(boolValue{&c.ignoreCase}, "i", "ignore-case", "", "match patterns case-insensitively")
+}
+
+func (c *config) xattrsFlag(fs *flagSet, help string) {
+	fs.add(boolValue{&c.xattrs}, "", "xattrs", "", help)
+	fs.add(listValue{&c.xattrInclude}, "", "xattrs-include", "<pattern>", "only attributes matching pattern or namespace,\nlike 'user.*' or 'user'")
+	fs.add(listValue{&c.xattrExclude}, "", "xattrs-exclude", "<pattern>", "skip attributes matching pattern or namespace")
+}
+
+func (c *config) dictSizeFlag(fs *flagSet) {
+	fs.add(sizeValue{&c.dictSize}, "", "dict-size", "<size>", "set size of trained dictionary (default: 112K)")
+}
+
+func (c *config) verboseFlag(fs *flagSet) {
+	fs.add(boolValue{&c.verbose}, "v", "verbose", "", "verbose mode")
+}
+
+// usageError is error in command line arguments
+type usageError struct {
+	err error
+}
+
+func (e usageError) Error() string {
+	return e.err.Error()
+}
+
+func newUsageError(format string, args ...any) error {
+	return usageError{fmt.Errorf(format, args...)}
+}
+
+type command struct {
+	name    string
+	args    string
+	summary string
+	flags   func(c *config, fs *flagSet)
+	run     func(ctx context.Context, c *config, args []string) error
+}
+
+var commands []*command
+
+func init() {
+	commands = []*command{
+		{
+			name:    "create",
+			args:    "[pattern...]",
+			summary: "create archive with files matching patterns (default: '*')",
+			flags: func(c *config, fs *flagSet) {
+				c.fileFlag(fs)
+				fs.add(boolValue{&c.appendTo}, "r", "append", "", "append files to existing archive, it is created if it is missing,\ncompression and dictionary of archive are used,\ncompressed archive is decompressed to its end before appending")
+				c.dirFlag(fs, "pack files from directory <dir>")
+				fs.add(listValue{&c.filesFrom}, "T", "files-from", "<file>", "pack files listed in <file> ('-' means stdin)")
+				fs.add(boolValue{&c.null}, "", "null", "", "names in --files-from are separated by NUL")
+				fs.add(listValue{&c.excludes}, "e", "exclude", "<pattern>", "exclude files")
+				fs.add(listValue{&c.excludeFrom}, "X", "exclude-from", "<file>", "exclude files matching patterns from <file>\n(in format of .gitignore)")
+				fs.add(boolValue{&c.excludeVCS}, "", "exclude-vcs", "", "exclude directories .git, .svn and .hg")
+				fs.add(boolValue{&c.gitignore}, "", "gitignore", "", "exclude files listed in .gitignore files, like in "+rawpack.RpkIgnore)
+				c.ignoreCaseFlag(fs)
+				fs.add(codecValue{&c.codec}, "", "codec", "<codec>", "compress archive with <codec> (zstd, gzip, s2, snappy, flate)")
+				c.zstdFlag(fs, "apply ZSTD compression")
+				fs.add(codecValue{&c.entryCodec}, "", "entry-codec", "<codec>", "compress each file with <codec> instead of whole archive,\nincompressible files are stored as is")
+				fs.add(incompressibleValue{&c.incompress}, "", "incompressible", "<spec>", "set detection of incompressible files for --entry-codec\n(see 'rpk help create')")
+				fs.add(stringValue{&c.dict}, "", "dict", "<file>", "compress with ZSTD dictionary from <file> (--zstd or --entry-codec=zstd),\nit is stored in archive")
+				fs.add(boolValue{&c.trainDict}, "", "train-dict", "", "train ZSTD dictionary from packed files,\nit is stored in archive")
+				c.dictSizeFlag(fs)
+				fs.add(boolValue{&c.sparse}, "S", "sparse", "", "store only data of sparse files, holes are recreated on extraction")
+				c.xattrsFlag(fs, "store extended attributes and ACLs of files,\nfails for directories with selected attributes")
+				fs.add(boolValue{&c.reproducible}, "", "reproducible", "", "create the same archive from the same files on any machine,\nfiles are sorted by name, ZSTD parameters are not tuned")
+				c.passwordFlag(fs, true)
+				fs.add(stringValue{&c.stdinName}, "", "stdin-name", "<name>", "add stdin to archive as file <name>")
+				c.jobsFlag(fs, "set count of reading threads (default: 4)")
+				fs.add(sizeValue{&c.readAhead}, "", "read-ahead", "<size>", "limit memory for reading ahead (default: 64M)")
+				c.bufferSizeFlag(fs)
+				c.verboseFlag(fs)
+			},
+			run: func(ctx context.Context, c *config, args []string) error {
+				root := c.dir
+				if len(c.stdinName) > 0 && len(args) == 0 && len(c.filesFrom) == 0 {
+					root = ""
+				}
+				opts, err := c.options(ctx, args)
+				if err != nil {
+					return err
+				}
+				for _, it := range c.filesFrom {
+					if isStdIOFile(it) && len(c.stdinName) > 0 {
+						return newUsageError("stdin cannot be used both for --files-from and --stdin-name")
+					}
+					list, err := readFileList(it, c.null)
+					if err != nil {
+						return err
+					}
+					opts.Files = append(opts.Files, list...)
+				}
+				if len(c.stdinName) > 0 {
+					opts.Sources = append(opts.Sources, rawpack.Source{Name: c.stdinName, Reader: os.Stdin})
+				}
+				return packArchive(ctx, c.name, root, opts, c.appendTo, c.verbose)
+			},
+		},
+		{
+			name:    "extract",
+			summary: "extract archive",
+			flags: func(c *config, fs *flagSet) {
+				c.fileFlag(fs)
+				c.dirFlag(fs, "extract files to directory <dir>")
+				fs.add(codecValue{&c.codec}, "", "codec", "<codec>", "read archive compressed with <codec>,\nit is detected by default, except flate")
+				c.zstdFlag(fs, "read ZSTD compressed archive")
+				c.passwordFlag(fs, false)
+				c.xattrsFlag(fs, "restore extended attributes and ACLs of files")
+				c.jobsFlag(fs, "set count of writing threads (default: 4)")
+				c.bufferSizeFlag(fs)
+				c.verboseFlag(fs)
+			},
+			run: func(ctx context.Context, c *config, args []string) error {
+				if len(args) > 0 {
+					return newUsageError("unexpected arguments %q", args)
+				}
+				opts, err := c.options(ctx, nil)
+				if err != nil {
+					return err
+				}
+				return unpackArchive(ctx, c.name, c.dir, opts, c.verbose)
+			},
+		},
+		{
+			name:    "list",
+			summary: "list files in archive",
+			flags: func(c *config, fs *flagSet) {
+				c.fileFlag(fs)
+				fs.add(codecValue{&c.codec}, "", "codec", "<codec>", "read archive compressed with <codec>,\nit is detected by default, except flate")
+				c.zstdFlag(fs, "read ZSTD compressed archive")
+				c.passwordFlag(fs, false)
+				fs.add(formatValue{&c.format}, "", "format", "<format>", "set output format (text, json, jsonl, csv)")
+				c.verboseFlag(fs)
+			},
+			run: func(ctx context.Context, c *config, args []string) error {
+				if len(args) > 0 {
+					return newUsageError("unexpected arguments %q", args)
+				}
+				opts, err := c.options(ctx, nil)
+				if err != nil {
+					return err
+				}
+				return listArchive(ctx, c.name, opts, c.format, c.verbose)
+			},
+		},
+		{
+			name:    "test",
+			summary: "read all files of archive and check its integrity",
+			flags: func(c *config, fs *flagSet) {
+				c.fileFlag(fs)
+				fs.add(codecValue{&c.codec}, "", "codec", "<codec>", "read archive compressed with <codec>,\nit is detected by default, except flate")
+				c.zstdFlag(fs, "read ZSTD compressed archive")
+				c.passwordFlag(fs, false)
+				fs.add(sizeValue{&c.bufferSize}, "", "buffer-size", "<size>", "set size of I/O buffer (default: 1M)")
+				c.verboseFlag(fs)
+			},
+			run: func(ctx context.Context, c *config, args []string) error {
+				if len(args) > 0 {
+					return newUsageError("unexpected arguments %q", args)
+				}
+				opts, err := c.options(ctx, nil)
+				if err != nil {
+					return err
+				}
+				return testArchive(ctx, c.name, opts, c.verbose)
+			},
+		},
+		{
+			name:    "cat",
+			args:    "[pattern...]",
+			summary: "write files matching patterns (default: '*') to stdout",
+			flags: func(c *config, fs *flagSet) {
+				c.fileFlag(fs)
+				fs.add(codecValue{&c.codec}, "", "codec", "<codec>", "read archive compressed with <codec>,\nit is detected by default, except flate")
+				c.zstdFlag(fs, "read ZSTD compressed archive")
+				c.passwordFlag(fs, false)
+				c.ignoreCaseFlag(fs)
+				fs.add(separatorValue{&c.separator}, "", "separator", "<text>", "write <text> between files,\n'{}' is replaced with name of next file,\nescapes \\n, \\t, \\r, \\0, \\\\, \\\" and \\xNN are supported")
+			},
+			run: func(ctx context.Context, c *config, args []string) error {
+				opts, err := c.options(ctx, args)
+				if err != nil {
+					return err
+				}
+				return catArchive(ctx, c.name, c.separator, opts)
+			},
+		},
+		{
+			name:    "delete",
+			args:    "<pattern...>",
+			summary: "remove files matching patterns from archive",
+			flags: func(c *config, fs *flagSet) {
+				c.fileFlag(fs)
+				c.editFlags(fs)
+				c.ignoreCaseFlag(fs)
+				c.verboseFlag(fs)
+			},
+			run: func(ctx context.Context, c *config, args []string) error {
+				if len(args) == 0 {
+					return newUsageError("patterns of files are not specified")
+				}
+				opts, err := c.options(ctx, nil)
+				if err != nil {
+					return err
+				}
+				return deleteMembers(ctx, c.name, args, opts, c.verbose)
+			},
+		},
+		{
+			name:    "rename",
+			args:    "<old> <new>",
+			summary: "rename file or directory in archive",
+			flags: func(c *config, fs *flagSet) {
+				c.fileFlag(fs)
+				c.editFlags(fs)
+				c.verboseFlag(fs)
+			},
+			run: func(ctx context.Context, c *config, args []string) error {
+				if len(args) != 2 {
+					return newUsageError("old and new names are expected")
+				}
+				opts, err := c.options(ctx, nil)
+				if err != nil {
+					return err
+				}
+				return renameMembers(ctx, c.name, args[0], args[1], opts, c.verbose)
+			},
+		},
+		{
+			name:    "serve",
+			summary: "serve archive contents over HTTP",
+			flags: func(c *config, fs *flagSet) {
+				c.fileFlag(fs)
+				c.passwordFlag(fs, false)
+				fs.add(stringValue{&c.listen}, "", "listen", "<address>", "set address to serve on (default: 127.0.0.1:8080)")
+			},
+			run: func(ctx context.Context, c *config, args []string) error {
+				if len(args) > 0 {
+					return newUsageError("unexpected arguments %q", args)
+				}
+				opts, err := c.options(ctx, nil)
+				if err != nil {
+					return err
+				}
+				return serveArchive(ctx, c.name, c.listen, opts)
+			},
+		},
+		{
+			name:    "dict",
+			args:    "train [pattern...]",
+			summary: "train ZSTD dictionary from files matching patterns (default: '*')",
+			flags: func(c *config, fs *flagSet) {
+				fs.add(stringValue{&c.output}, "o", "output", "<file>", "write dictionary to <file> ('-' means stdout)")
+				c.dirFlag(fs, "take files from directory <dir>")
+				fs.add(listValue{&c.excludes}, "e", "exclude", "<pattern>", "exclude files")
+				c.ignoreCaseFlag(fs)
+				c.dictSizeFlag(fs)
+				c.verboseFlag(fs)
+			},
+			run: func(ctx context.Context, c *config, args []string) error {
+				if len(args) == 0 || args[0] != "train" {
+					return newUsageError("expected 'train' after 'dict'")
+				}
+				opts, err := c.options(ctx, args[1:])
+				if err != nil {
+					return err
+				}
+				return trainDict(ctx, c.output, c.dir, opts, int(c.dictSize), c.verbose)
+			},
+		},
+		{
+			name:    "bench",
+			args:    "[pattern...]",
+			summary: "measure codecs and ZSTD parameters on files matching patterns",
+			flags: func(c *config, fs *flagSet) {
+				c.dirFlag(fs, "take files from directory <dir>")
+				fs.add(listValue{&c.excludes}, "e", "exclude", "<pattern>", "exclude files")
+				c.ignoreCaseFlag(fs)
+				fs.add(sizeValue{&c.sampleSize}, "", "sample", "<size>", "limit size of sampled files (default: 32M)")
+				fs.add(listValue{&c.bench.codecs}, "", "codecs", "<list>", "set codecs (default: zstd,gzip,s2,snappy,flate)")
+				fs.add(listValue{&c.bench.levels}, "", "levels", "<list>", "set ZSTD levels (default: low,mid,high,best)")
+				fs.add(listValue{&c.bench.threads}, "", "threads", "<list>", "set ZSTD threads counts (default: 1 and count of CPUs)")
+				fs.add(listValue{&c.bench.windows}, "", "windows", "<list>", "set ZSTD window sizes (default: 1M,8M,64M)")
+				fs.add(sizeValue{&c.minSpeed}, "", "min-speed", "<size>", "recommend the best ratio with compression speed\nof at least <size> per second (default: 100M)")
+				fs.add(formatValue{&c.format}, "", "format", "<format>", "set output format (text, json, jsonl, csv)")
+				c.verboseFlag(fs)
+			},
+			run: func(ctx context.Context, c *config, args []string) error {
+				opts, err := c.options(ctx, args)
+				if err != nil {
+					return err
+				}
+				sampleSize, minSpeed := c.sampleSize, c.minSpeed
+				if sampleSize == 0 {
+					sampleSize = defaultBenchSample
+				}
+				if minSpeed == 0 {
+					minSpeed = defaultMinSpeed
+				}
+				// speed of output storage is not limiting, like for archive written to fast disk
+				opts.BufferSize, opts.WriteSpeed = tuneIO("", 0)
+				return benchArchive(ctx, c.dir, opts, c.bench, sampleSize, minSpeed, c.format, c.verbose)
+			},
+		},
+		{
+			name:    "version",
+			summary: "show version",
+			flags:   func(c *config, fs *flagSet) {},
+			run: func(ctx context.Context, c *config, args []string) error {
+				version()
+				return nil
+			},
+		},
+		{
+			name:    "help",
+			args:    "[command]",
+			summary: "show help for command",
+			flags:   func(c *config, fs *flagSet) {},
+			run: func(ctx context.Context, c *config, args []string) error {
+				if len(args) == 0 {
+					help()
+				}
+				cmd := findCommand(args[0])
+				if cmd == nil {
+					return newUsageError("unknown command %q", args[0])
+				}
+				cmd.help()
+				return nil
+			},
+		},
+	}
+}
+
+func findCommand(name string) *command {
+	for _, it := range commands {
+		if it.name == name {
+			return it
+		}
+	}
+	return nil
+}
+
+func (cmd *command) newFlagSet(c *config) *flagSet {
+	fs := newFlagSet(cmd.name)
+	cmd.flags(c, fs)
+	return fs
+}
+
+func (cmd *command) exec(ctx context.Context, args []string) error {
+	c := &config{
+		dir:    ".",
+		listen: "127.0.0.1:8080",
+	}
+	fs := cmd.newFlagSet(c)
+	args, err := fs.parse(args)
+	if errors.Is(err, flag.ErrHelp) {
+		cmd.help()
+	} else if err != nil {
+		return usageError{err}
+	}
+	return cmd.run(ctx, c, args)
+}
@@ -1,20 +1,18 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
-	"io/fs"
 	"os"
 	"path/filepath"
-	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/egor9814/rawpack"
 )
 
-var wd string
-
 func isStdIOFile(name string) bool {
 	return len(name) == 0 || name == "-"
 }
@@ -31,129 +29,104 @@ func openFileForRead(name string) (io.Reader, io.Closer, error) {
 	}
 }
 
-func openFileForWrite(name string) (io.Writer, io.Closer, error) {
+// openFileForWrite returns writer, which creates file on first write,
+// so the file is not created if packing fails before writing.
+// Returned file is nil for stdout.
+func openFileForWrite(name string) (io.Writer, *lazyFile) {
 	if isStdIOFile(name) {
-		return os.Stdout, nil, nil
-	} else {
-		f, err := rawpack.File{Name: name}.Write()
+		return os.Stdout, nil
+	}
+	f := &lazyFile{name: name}
+	return f, f
+}
+
+type lazyFile struct {
+	name string
+	f    io.WriteCloser
+}
+
+func (f *lazyFile) Write(b []byte) (int, error) {
+	if f.f == nil {
+		wc, err := rawpack.File{Name: f.name}.Write()
 		if err != nil {
-			return nil, nil, err
+			return 0, err
 		}
-		return f, f, nil
+		f.f = wc
 	}
+	return f.f.Write(b)
 }
 
-func chdir() error {
-	if info, err := os.Stat(wd); err != nil {
-		if err := os.MkdirAll(wd, 0755); err != nil {
-			return err
-		}
-	} else if !info.IsDir() {
-		return fmt.Errorf("expected dir at %q", wd)
+func (f *lazyFile) Close() error {
+	if f.f == nil {
+		return nil
 	}
-	return os.Chdir(wd)
+	return f.f.Close()
 }
 
-func regexFromPattern(pattern string) (*regexp.Regexp, error) {
-	pattern = filepath.ToSlash(pattern)
-	var sb strings.Builder
-	sb.WriteByte('^')
-	for _, r := range pattern {
-		switch r {
-		case '*':
-			sb.WriteByte('.')
-			sb.WriteByte('*')
-		case '?':
-			sb.WriteByte('.')
-		case '.', '(', ')', '+', '|', '^', '$', '[', ']', '{', '}', '\\':
-			sb.WriteByte('\\')
-			sb.WriteRune(r)
-		default:
-			sb.WriteRune(r)
-		}
+// remove closes and removes file, if it was created
+func (f *lazyFile) remove() {
+	if f.f == nil {
+		return
+	}
+	handleClosing(f.f, f.name)
+	f.f = nil
+	if err := os.Remove(f.name); err != nil {
+		logf("warning: cannot remove incomplete file %q: %v\n", f.name, err)
 	}
-	sb.WriteByte('$')
-	return regexp.Compile(sb.String())
 }
 
-func findFiles(includePatterns, excludePatterns []string, verbose bool) (f rawpack.FileTable, err error) {
-	f = make(rawpack.FileTable, 0, 32)
-	err = filepath.WalkDir(".", func(p string, d fs.DirEntry, err error) error {
-		if err != nil {
-			return err
-		}
-		if d.IsDir() {
-			return nil
-		}
-		p = filepath.ToSlash(p)
-		for _, it := range excludePatterns {
-			r, err := regexFromPattern(it)
-			if err != nil {
-				return err
-			}
-			if r.MatchString(p) {
-				return nil
-			}
-		}
-		for _, it := range includePatterns {
-			r, err := regexFromPattern(it)
-			if err != nil {
-				return err
-			}
-			if r.MatchString(p) {
-				if info, err := d.Info(); err != nil {
-					return err
-				} else {
-					f = append(f, rawpack.File{Name: p, Size: uint64(info.Size())})
-					if verbose {
-						logf("\r%d", len(f))
-					}
-				}
-			}
-		}
-		return nil
-	})
-	return
+// contextReader fails reading after cancellation of ctx, like reading of files by library
+type contextReader struct {
+	ctx  context.Context
+	name string
+	r    io.Reader
+}
+
+func (r *contextReader) Read(b []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, &rawpack.CancelError{File: r.name, Err: err}
+	}
+	return r.r.Read(b)
 }
 
-func copyBuffer(dst io.Writer, src io.Reader, size uint64, buf []byte, verbose bool) (written uint64, err error) {
-	// copy of io.copyBuffer, without WriterTo and ReaderFrom, with log
-	src = io.LimitReader(src, int64(size))
-	for {
-		nr, er := src.Read(buf)
-		if nr > 0 {
-			nw, ew := dst.Write(buf[0:nr])
-			if nw < 0 || nr < nw {
-				nw = 0
-				if ew == nil {
-					ew = errors.New("invalid write result")
-				}
-			}
-			written += uint64(nw)
-			if verbose {
-				logf("\r%d/%d bytes", written, size)
-			}
-			if ew != nil {
-				err = ew
-				break
-			}
-			if nr != nw {
-				err = io.ErrShortWrite
-				break
-			}
+func parseSize(s string) (uint64, error) {
+	s = strings.TrimSuffix(s, "B")
+	shift := 0
+	if l := len(s); l > 0 {
+		switch s[l-1] {
+		case 'G':
+			shift = 30
+		case 'M':
+			shift = 20
+		case 'K':
+			shift = 10
 		}
-		if er != nil {
-			if er != io.EOF {
-				err = er
-			}
-			break
+		if shift != 0 {
+			s = s[:l-1]
 		}
 	}
-	return written, err
+	n, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return n << shift, nil
 }
 
 func handleCommand(err error) {
+	if errors.Is(err, context.Canceled) {
+		logln("canceled")
+		os.Exit(130)
+	}
+	var ue usageError
+	if errors.As(err, &ue) {
+		logf("error: %v\n", err)
+		logf("type '%s help' for usage\n", filepath.Base(os.Args[0]))
+		os.Exit(2)
+	}
 	if err != nil {
+		if errors.Is(err, rawpack.ErrInvalidSignature) {
+			err = fmt.Errorf("%w (maybe incorrect password)", err)
+		}
 		logf("error: %v\n", err)
 		os.Exit(1)
 	}
@@ -169,6 +142,14 @@ func handleClosing(c io.Closer, tag string) {
 }
 
 func noMode() {
-	logln("error: mode not specified (-c, -x or -l), or type '--help'")
-	os.Exit(1)
+	handleCommand(newUsageError("command not specified"))
+}
+
+func readFileList(name string, null bool) ([]string, error) {
+	r, c, err := openFileForRead(name)
+	if err != nil {
+		return nil, err
+	}
+	defer handleClosing(c, name)
+	return rawpack.ReadFileList(r, null)
 }
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package main
+
+// deviceID is not supported, so parameters of storage are not measured
+func deviceID(path string) (uint64, bool) {
+	return 0, false
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"context"
+
+	"github.com/egor9814/rawpack"
+)
+
+func trainDict(ctx context.Context, name, root string, opts rawpack.Options, size int, verbose bool) error {
+	if verbose {
+		logf("training dictionary from %q...\n", root)
+	}
+	d, err := rawpack.TrainZstdDict(ctx, root, opts, size)
+	if err != nil {
+		return err
+	}
+	w, f := openFileForWrite(name)
+	if f != nil {
+		defer handleClosing(f, name)
+	}
+	if _, err := w.Write(d); err != nil {
+		if f != nil {
+			f.remove()
+		}
+		return err
+	}
+	if verbose {
+		logf("done! dictionary of %s\n", formatBytes(float64(len(d))))
+	}
+	return nil
+}
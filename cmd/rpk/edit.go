@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/egor9814/rawpack"
+)
+
+// rewriteArchive writes archive name changed by edit to temporary file in the same directory,
+// and renames it to name, so the archive is replaced atomically
+func rewriteArchive(ctx context.Context, name string, opts rawpack.Options, verbose bool, edit func(f *rawpack.File) (bool, error)) (err error) {
+	if isStdIOFile(name) {
+		return newUsageError("archive file must be specified")
+	}
+	src, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer handleClosing(src, name)
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("%s: archive is not regular file", name)
+	}
+	if verbose {
+		logf("rewriting archive %q...\n", name)
+	}
+
+	dir := filepath.Dir(name)
+	opts.BufferSize, opts.WriteSpeed = tuneIO(dir, uint64(opts.BufferSize))
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(name)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tmp.Close()
+			_ = os.Remove(tmp.Name())
+		}
+	}()
+
+	pl := newProgressLog("copied", verbose)
+	opts.Progress = pl
+	if err := rawpack.Rewrite(ctx, tmp, src, info.Size(), opts, edit); err != nil {
+		if errors.Is(err, rawpack.ErrNotModified) {
+			return errNotFound
+		}
+		return err
+	}
+	if err := tmp.Chmod(info.Mode().Perm()); err != nil {
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), name); err != nil {
+		return err
+	}
+	pl.finish()
+	return nil
+}
+
+// errNotFound is returned by rewriteArchive, when edit doesn't change files, archive is not written then
+var errNotFound = errors.New("no files in archive match specified arguments")
+
+func deleteMembers(ctx context.Context, name string, patterns []string, opts rawpack.Options, verbose bool) error {
+	matcher, err := rawpack.CompilePatterns(patterns, opts.IgnoreCase)
+	if err != nil {
+		return newUsageError("%v", err)
+	}
+	err = rewriteArchive(ctx, name, opts, verbose, func(f *rawpack.File) (bool, error) {
+		if !matcher.Match(f.Name) {
+			return true, nil
+		}
+		if verbose {
+			logf("deleting %s\n", f.Name)
+		}
+		return false, nil
+	})
+	if err == errNotFound {
+		return errors.New("no files in archive match specified patterns")
+	}
+	return err
+}
+
+// renameMembers renames file from to name to, or directory from with all its files
+func renameMembers(ctx context.Context, name, from, to string, opts rawpack.Options, verbose bool) error {
+	from, to = strings.TrimSuffix(from, "/"), strings.TrimSuffix(to, "/")
+	if len(from) == 0 || len(to) == 0 {
+		return newUsageError("empty name")
+	}
+	// names of files are mapped to true, if file is renamed, appended segments may repeat names of other files
+	names := make(map[string]bool)
+	matched := false
+	err := rewriteArchive(ctx, name, opts, verbose, func(f *rawpack.File) (bool, error) {
+		renamed := f.Name == from || strings.HasPrefix(f.Name, from+"/")
+		if renamed {
+			matched = true
+			n := to + f.Name[len(from):]
+			if verbose {
+				logf("renaming %s to %s\n", f.Name, n)
+			}
+			f.Name = n
+		}
+		if r, ok := names[f.Name]; ok && (r || renamed) {
+			return false, fmt.Errorf("file %q already exists in archive", f.Name)
+		}
+		names[f.Name] = names[f.Name] || renamed
+		return true, nil
+	})
+	if err == errNotFound {
+		if !matched {
+			return fmt.Errorf("file %q is not found in archive", from)
+		}
+		// names are not changed, archive is left as is
+		if verbose {
+			logf("nothing to rename\n")
+		}
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,344 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/egor9814/rawpack"
+)
+
+type stringValue struct {
+	p *string
+}
+
+func (v stringValue) String() string {
+	if v.p == nil {
+		return ""
+	}
+	return *v.p
+}
+
+func (v stringValue) Set(s string) error {
+	*v.p = s
+	return nil
+}
+
+type boolValue struct {
+	p *bool
+}
+
+func (v boolValue) String() string {
+	if v.p == nil {
+		return ""
+	}
+	return strconv.FormatBool(*v.p)
+}
+
+func (v boolValue) Set(s string) error {
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		return err
+	}
+	*v.p = b
+	return nil
+}
+
+func (v boolValue) IsBoolFlag() bool {
+	return true
+}
+
+type listValue struct {
+	p *[]string
+}
+
+func (v listValue) String() string {
+	if v.p == nil {
+		return ""
+	}
+	return strings.Join(*v.p, ",")
+}
+
+func (v listValue) Set(s string) error {
+	*v.p = append(*v.p, s)
+	return nil
+}
+
+type jobsValue struct {
+	p *int
+}
+
+func (v jobsValue) String() string {
+	if v.p == nil {
+		return ""
+	}
+	return strconv.Itoa(*v.p)
+}
+
+func (v jobsValue) Set(s string) error {
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 1 {
+		return fmt.Errorf("invalid jobs count %q", s)
+	}
+	*v.p = n
+	return nil
+}
+
+type sizeValue struct {
+	p *uint64
+}
+
+func (v sizeValue) String() string {
+	if v.p == nil {
+		return ""
+	}
+	return strconv.FormatUint(*v.p, 10)
+}
+
+func (v sizeValue) Set(s string) error {
+	n, err := parseSize(s)
+	if err != nil {
+		return fmt.Errorf("invalid size %q", s)
+	}
+	*v.p = n
+	return nil
+}
+
+// zstdValue may be used without value (auto parameters) as bool flag
+type zstdValue struct {
+	p **rawpack.ZstdOptions
+}
+
+func (v zstdValue) String() string {
+	return ""
+}
+
+func (v zstdValue) Set(s string) error {
+	if s == "true" {
+		s = ""
+	}
+	i, err := rawpack.ParseZstdOptions(s)
+	if err != nil {
+		return err
+	}
+	*v.p = i
+	return nil
+}
+
+func (v zstdValue) IsBoolFlag() bool {
+	return true
+}
+
+type formatValue struct {
+	p *listFormat
+}
+
+func (v formatValue) String() string {
+	return ""
+}
+
+func (v formatValue) Set(s string) error {
+	f, err := parseListFormat(s)
+	if err != nil {
+		return err
+	}
+	*v.p = f
+	return nil
+}
+
+type separatorValue struct {
+	p *string
+}
+
+func (v separatorValue) String() string {
+	return ""
+}
+
+func (v separatorValue) Set(s string) error {
+	sep, err := parseSeparator(s)
+	if err != nil {
+		return fmt.Errorf("invalid separator %q: %v", s, err)
+	}
+	*v.p = sep
+	return nil
+}
+
+type option struct {
+	short, long, arg, help string
+}
+
+// flagSet is flag.FlagSet with short and long names of options, and usage in rpk's style
+type flagSet struct {
+	*flag.FlagSet
+	options []option
+}
+
+func newFlagSet(name string) *flagSet {
+	fs := &flagSet{
+		FlagSet: flag.NewFlagSet(name, flag.ContinueOnError),
+	}
+	fs.SetOutput(io.Discard)
+	return fs
+}
+
+// add registers v with names -short and --long, short may be empty. arg is shown in usage as option argument.
+func (fs *flagSet) add(v flag.Value, short, long, arg, help string) {
+	if len(short) > 0 {
+		fs.Var(v, short, help)
+	}
+	fs.Var(v, long, help)
+	fs.options = append(fs.options, option{short, long, arg, help})
+}
+
+// parse parses flags mixed with positional arguments, all arguments after '--' are positional
+func (fs *flagSet) parse(args []string) ([]string, error) {
+	positional := make([]string, 0, len(args))
+	for len(args) > 0 {
+		if err := fs.Parse(args); err != nil {
+			// errors of optional values (--zstd) are reported like errors of other values
+			if msg, ok := strings.CutPrefix(err.Error(), "invalid boolean value "); ok {
+				err = errors.New("invalid value " + strings.Replace(msg, " for -", " for flag -", 1))
+			}
+			return nil, err
+		}
+		rest := fs.Args()
+		if consumed := len(args) - len(rest); consumed > 0 && args[consumed-1] == "--" {
+			positional = append(positional, rest...)
+			break
+		}
+		if len(rest) == 0 {
+			break
+		}
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
+	return positional, nil
+}
+
+func (fs *flagSet) printOptions(w io.Writer) {
+	_, _ = fmt.Fprintln(w, "options:")
+	for _, it := range fs.options {
+		var sb strings.Builder
+		if len(it.short) > 0 {
+			sb.WriteString("  -" + it.short + ", ")
+		} else {
+			sb.WriteString("      ")
+		}
+		sb.WriteString("--" + it.long)
+		if strings.HasPrefix(it.arg, "[") {
+			sb.WriteString(it.arg)
+		} else if len(it.arg) > 0 {
+			sb.WriteString(" " + it.arg)
+		}
+		name := sb.String()
+		if len(name) < 29 {
+			name += strings.Repeat(" ", 29-len(name))
+		} else {
+			name += " "
+		}
+		lines := strings.Split(it.help, "\n")
+		_, _ = fmt.Fprintln(w, name+lines[0])
+		for _, l := range lines[1:] {
+			_, _ = fmt.Fprintln(w, strings.Repeat(" ", 29)+l)
+		}
+	}
+	_, _ = fmt.Fprintln(w, "  -h, --help                 show help")
+}
+
+// passwordFlags are options of password sources, only one of them may be used
+type passwordFlags struct {
+	value, file, env, fd string
+	prompt, confirm      bool
+}
+
+func (p *passwordFlags) source(ctx context.Context) (rawpack.PasswordSource, error) {
+	var sources []rawpack.PasswordSource
+	if len(p.value) > 0 {
+		sources = append(sources, rawpack.PasswordBytes([]byte(p.value)))
+	}
+	if len(p.file) > 0 {
+		sources = append(sources, rawpack.PasswordFile(p.file))
+	}
+	if len(p.env) > 0 {
+		sources = append(sources, rawpack.PasswordEnv(p.env))
+	}
+	if len(p.fd) > 0 {
+		fd, err := strconv.ParseUint(p.fd, 10, 31)
+		if err != nil {
+			return nil, newUsageError("invalid file descriptor %q", p.fd)
+		}
+		sources = append(sources, rawpack.PasswordFD(uintptr(fd)))
+	}
+	if p.prompt {
+		sources = append(sources, promptPassword(ctx, p.confirm))
+	}
+	switch len(sources) {
+	case 0:
+		return nil, nil
+	case 1:
+		return sources[0], nil
+	default:
+		return nil, newUsageError("only one password source may be specified")
+	}
+}
+
+type codecValue struct {
+	p *rawpack.Codec
+}
+
+func (v codecValue) String() string {
+	return ""
+}
+
+func (v codecValue) Set(s string) error {
+	c, err := rawpack.ParseCodec(s)
+	if err != nil {
+		return err
+	}
+	*v.p = c
+	return nil
+}
+
+// incompressibleValue parses comma-separated settings: sample=<size>, entropy=<bits>, saving=<part>, nomagic
+type incompressibleValue struct {
+	p *rawpack.IncompressibleOptions
+}
+
+func (v incompressibleValue) String() string {
+	return ""
+}
+
+func (v incompressibleValue) Set(s string) error {
+	for _, it := range strings.Split(s, ",") {
+		key, value, _ := strings.Cut(it, "=")
+		var err error
+		switch key {
+		case "sample":
+			var n uint64
+			if n, err = parseSize(value); err == nil && (n == 0 || n > 1<<30) {
+				err = errors.New("out of range")
+			}
+			v.p.SampleSize = int(n)
+		case "entropy":
+			if v.p.MaxEntropy, err = strconv.ParseFloat(value, 64); err == nil && (v.p.MaxEntropy <= 0 || v.p.MaxEntropy > 8) {
+				err = errors.New("expected bits per byte in range (0, 8]")
+			}
+		case "saving":
+			if v.p.MinSaving, err = strconv.ParseFloat(value, 64); err == nil && (v.p.MinSaving <= 0 || v.p.MinSaving >= 1) {
+				err = errors.New("expected part of size in range (0, 1)")
+			}
+		case "nomagic":
+			v.p.NoMagic = true
+		default:
+			return fmt.Errorf("unknown setting %q, expected sample, entropy, saving or nomagic", key)
+		}
+		if err != nil {
+			return fmt.Errorf("invalid %s %q: %w", key, value, err)
+		}
+	}
+	return nil
+}
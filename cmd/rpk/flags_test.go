@@ -0,0 +1,71 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/egor9814/rawpack"
+)
+
+func TestFlagSetParse(t *testing.T) {
+	tests := []struct {
+		args       []string
+		positional []string
+		verbose    bool
+		file       string
+		zstd       bool
+	}{
+		{nil, []string{}, false, "", false},
+		{[]string{"a", "b"}, []string{"a", "b"}, false, "", false},
+		// options may follow positional arguments
+		{[]string{"a", "-v", "b", "-f", "x.rpk", "c"}, []string{"a", "b", "c"}, true, "x.rpk", false},
+		{[]string{"--file=x.rpk", "--verbose"}, []string{}, true, "x.rpk", false},
+		{[]string{"--zstd", "a"}, []string{"a"}, false, "", true},
+		{[]string{"--zstd=l=low", "a"}, []string{"a"}, false, "", true},
+		// arguments after '--' are positional
+		{[]string{"a", "--", "-v", "--", "b"}, []string{"a", "-v", "--", "b"}, false, "", false},
+		{[]string{"-f", "--", "--", "-v"}, []string{"-v"}, false, "--", false},
+		{[]string{"-", "-v"}, []string{"-"}, true, "", false},
+	}
+	for _, tt := range tests {
+		var verbose bool
+		var file string
+		var zstd *rawpack.ZstdOptions
+		fs := newFlagSet("test")
+		fs.add(boolValue{&verbose}, "v", "verbose", "", "")
+		fs.add(stringValue{&file}, "f", "file", "<file>", "")
+		fs.add(zstdValue{&zstd}, "", "zstd", "[=<options>]", "")
+		positional, err := fs.parse(tt.args)
+		if err != nil {
+			t.Errorf("parse(%q): %v", tt.args, err)
+			continue
+		}
+		if !reflect.DeepEqual(positional, tt.positional) || verbose != tt.verbose || file != tt.file || (zstd != nil) != tt.zstd {
+			t.Errorf("parse(%q) = %q, verbose %v, file %q, zstd %v", tt.args, positional, verbose, file, zstd != nil)
+		}
+	}
+}
+
+func TestFlagSetParseErrors(t *testing.T) {
+	tests := map[string]string{
+		"-x":          "flag provided but not defined",
+		"--unknown":   "flag provided but not defined",
+		"-f":          "flag needs an argument",
+		"--zstd=l=0":  "invalid value",
+		"--verbose=x": "invalid value",
+	}
+	for arg, want := range tests {
+		var verbose bool
+		var file string
+		var zstd *rawpack.ZstdOptions
+		fs := newFlagSet("test")
+		fs.add(boolValue{&verbose}, "v", "verbose", "", "")
+		fs.add(stringValue{&file}, "f", "file", "<file>", "")
+		fs.add(zstdValue{&zstd}, "", "zstd", "[=<options>]", "")
+		_, err := fs.parse([]string{"a", arg})
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("parse(%q): got %v, want error containing %q", arg, err, want)
+		}
+	}
+}
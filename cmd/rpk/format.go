@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/egor9814/rawpack"
+)
+
+type listFormat byte
+
+const (
+	textFormat listFormat = iota
+	jsonFormat
+	jsonlFormat
+	csvFormat
+)
+
+func parseListFormat(s string) (listFormat, error) {
+	switch s {
+	case "text":
+		return textFormat, nil
+	case "json":
+		return jsonFormat, nil
+	case "jsonl":
+		return jsonlFormat, nil
+	case "csv":
+		return csvFormat, nil
+	default:
+		return textFormat, fmt.Errorf("unknown format %q, expected 'text', 'json', 'jsonl' or 'csv'", s)
+	}
+}
+
+func (f listFormat) String() string {
+	switch f {
+	case textFormat:
+		return "text"
+	case jsonFormat:
+		return "json"
+	case jsonlFormat:
+		return "jsonl"
+	case csvFormat:
+		return "csv"
+	default:
+		return fmt.Sprintf("format(%d)", byte(f))
+	}
+}
+
+type listEntry struct {
+	Name string `json:"name"`
+	Size uint64 `json:"size"`
+	// StoredSize is set for sparse files, which holes are not stored, and for compressed files
+	StoredSize *uint64 `json:"stored_size,omitempty"`
+	Type       string  `json:"type"`
+	Codec      string  `json:"codec,omitempty"`
+	Offset     *int64  `json:"offset,omitempty"`
+}
+
+func newListEntry(f *rawpack.File, offset *int64) listEntry {
+	e := listEntry{
+		Name:   f.Name,
+		Size:   f.ContentSize(),
+		Type:   "file",
+		Offset: offset,
+	}
+	if m, err := f.SparseMap(); err == nil && m != nil {
+		e.Type = "sparse"
+	}
+	if c, _, err := f.EntryCodec(); err == nil && c != rawpack.CodecNone {
+		e.Codec = c.String()
+	}
+	if e.Size != f.Size {
+		e.StoredSize = &f.Size
+	}
+	return e
+}
+
+// writeFileTable writes file table in specified format,
+// offsets may be nil, if archive is not seekable
+func writeFileTable(out io.Writer, ft rawpack.FileTable, offsets []int64, format listFormat) error {
+	offset := func(i int) *int64 {
+		if offsets == nil {
+			return nil
+		}
+		return &offsets[i]
+	}
+	switch format {
+	case jsonFormat:
+		entries := make([]listEntry, len(ft))
+		for i := range ft {
+			entries[i] = newListEntry(&ft[i], offset(i))
+		}
+		e := json.NewEncoder(out)
+		e.SetIndent("", "  ")
+		return e.Encode(entries)
+
+	case jsonlFormat:
+		e := json.NewEncoder(out)
+		for i := range ft {
+			if err := e.Encode(newListEntry(&ft[i], offset(i))); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case csvFormat:
+		w := csv.NewWriter(out)
+		// columns are fields of JSON, missing values are empty
+		_ = w.Write([]string{"name", "size", "stored_size", "type", "codec", "offset"})
+		for i := range ft {
+			e := newListEntry(&ft[i], offset(i))
+			stored, o := "", ""
+			if e.StoredSize != nil {
+				stored = strconv.FormatUint(*e.StoredSize, 10)
+			}
+			if e.Offset != nil {
+				o = strconv.FormatInt(*e.Offset, 10)
+			}
+			_ = w.Write([]string{e.Name, strconv.FormatUint(e.Size, 10), stored, e.Type, e.Codec, o})
+		}
+		w.Flush()
+		return w.Error()
+
+	default:
+		return fmt.Errorf("unknown list format %q", format)
+	}
+}
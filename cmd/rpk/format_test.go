@@ -0,0 +1,38 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/egor9814/rawpack"
+)
+
+func TestWriteFileTableCSV(t *testing.T) {
+	codec := binary.LittleEndian.AppendUint64(nil, 100)
+	ft := rawpack.FileTable{
+		{Name: "a.txt", Size: 5},
+		{Name: "b,log", Size: 20, Extensions: []rawpack.Extension{{Key: rawpack.ExtCodec, Value: append(codec, "zstd"...)}}},
+	}
+	tests := []struct {
+		name    string
+		offsets []int64
+		want    string
+	}{
+		{"seekable", []int64{40, 45}, "name,size,stored_size,type,codec,offset\n" +
+			"a.txt,5,,file,,40\n" +
+			"\"b,log\",100,20,file,zstd,45\n"},
+		{"stream", nil, "name,size,stored_size,type,codec,offset\n" +
+			"a.txt,5,,file,,\n" +
+			"\"b,log\",100,20,file,zstd,\n"},
+	}
+	for _, tt := range tests {
+		var out bytes.Buffer
+		if err := writeFileTable(&out, ft, tt.offsets, csvFormat); err != nil {
+			t.Fatal(err)
+		}
+		if out.String() != tt.want {
+			t.Errorf("%s: got\n%s\nwant\n%s", tt.name, out.String(), tt.want)
+		}
+	}
+}
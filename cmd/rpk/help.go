@@ -9,71 +9,196 @@ import (
 func help() {
 	exe := filepath.Base(os.Args[0])
 	fmt.Printf("%s: manipulate rawpack archive format\n", exe)
-	fmt.Printf("usage: %s [options...] [pattern...]\n", exe)
-	fmt.Println("options:")
-	fmt.Println("  -l, --list                 list archive")
-	fmt.Println("  -c, --create               create archive")
-	fmt.Println("  -x, --extract              extract archive")
-	fmt.Println("  -f, --file <name>          set output name")
-	fmt.Println("  -d, --dir <dir>            change dir")
-	fmt.Println("  -e, --exclude <pattern>    exclude files")
-	fmt.Println("      --zstd=<zstd_options>  apply ZSTD compression")
-	fmt.Println("  -p, --password <password>  set archive password")
-	fmt.Println("  -v, --verbose              verbose mode")
-	fmt.Println("  -V, --version              show version")
-	fmt.Println("  -h, --help                 show help")
+	fmt.Printf("usage: %s <command> [options...] [arguments...]\n", exe)
+	fmt.Printf("       %s -{c|r|x|l}[options...] [arguments...]\n", exe)
+	fmt.Println("commands:")
+	for _, it := range commands {
+		fmt.Printf("  %-9s %s\n", it.name, it.summary)
+	}
 	fmt.Println()
-	fmt.Println("pattern: {term}+")
-	fmt.Println("  term: [*?{c}]")
-	fmt.Println("  *: any printable characters")
-	fmt.Println("  ?: any one printable character")
-	fmt.Println("  c: specified printable character <c>")
+	fmt.Printf("type '%s help <command>' or '%s <command> --help' for options of command\n", exe, exe)
 	fmt.Println()
-	fmt.Println("pattern example:")
-	fmt.Println("  *.go")
-	fmt.Println("  file-?.txt")
-	fmt.Println()
-	fmt.Println("list archive example:")
-	fmt.Printf("  %s -lvf test.rpk\n", exe)
-	fmt.Println("    show files in archive 'test.rpk'")
-	fmt.Println()
-	fmt.Println("create archive example:")
+	fmt.Println("classic syntax:")
+	fmt.Println("  -l, -c, -x select 'list', 'create' or 'extract' command, -r selects 'create --append',")
+	fmt.Println("  other options may be combined with them, arguments of options follow in the same order")
 	fmt.Printf("  %s -cvfe test.rpk *.txt\n", exe)
-	fmt.Println("    create archive 'test.rpk', with all files in current directory")
-	fmt.Println("    without all '.txt' files")
-	fmt.Printf("  %s -cvfd test.rpk docs\n", exe)
-	fmt.Println("    create archive 'test.rpk', with all files in directory 'docs'")
-	fmt.Printf("  %s -cvfe test.rpk main.go *.go\n", exe)
-	fmt.Println("    create archive 'test.rpk', with all '.go' files in current directory")
-	fmt.Println("    without 'main.go' files")
-	fmt.Println()
-	fmt.Println("extract archive example:")
-	fmt.Printf("  %s -xvf test.rpk\n", exe)
-	fmt.Println("    extract files from archive 'test.rpk'")
+	fmt.Printf("    same as '%s create -v -f test.rpk -e *.txt'\n", exe)
 	fmt.Printf("  %s -xvfd test.rpk tmp\n", exe)
-	fmt.Println("    extract files from archive 'test.rpk' to directory 'tmp'")
+	fmt.Printf("    same as '%s extract -v -f test.rpk -d tmp'\n", exe)
+	fmt.Println()
+	printPatternHelp()
+	fmt.Println()
+	printZstdHelp(exe)
+	os.Exit(0)
+}
+
+func printPatternHelp() {
+	fmt.Println("pattern: [!]{term}+")
+	fmt.Println("  term: [*(**)?(class)(alternatives)(\\c){c}]")
+	fmt.Println("  *: any characters except '/'")
+	fmt.Println("  **: any characters including '/', when it is whole path segment")
+	fmt.Println("  ?: any one character except '/'")
+	fmt.Println("  class: [{c}(c-c)+] any one character of class except '/', '[!...]' negates class")
+	fmt.Println("  alternatives: {pattern(,pattern)+} any one of patterns")
+	fmt.Println("  \\c, c: specified character <c>")
+	fmt.Println("  pattern without '/' matches name of file in any directory,")
+	fmt.Println("  pattern starting with '!' excludes files matched by previous patterns")
 	fmt.Println()
-	fmt.Println("zstd_options: {zstd_option}(,{zstd_option})+")
+	fmt.Println("pattern example:")
+	fmt.Println("  *.go")
+	fmt.Println("  file-?.txt")
+	fmt.Println("  src/**/*.{go,mod}")
+	fmt.Println("  img-[0-9][0-9].png")
+}
+
+func printZstdHelp(exe string) {
+	fmt.Println("zstd_options: [{zstd_option}(,{zstd_option})*](;{zstd_rule})*")
 	fmt.Println("zstd_option: [(l={zstd_compression_level})")
 	fmt.Println("              (t={zstd_threads_count})")
-	fmt.Println("              (m={zstd_memory_limit})(auto)]")
-	fmt.Println("zstd_compression_level: [(low)(mid)(high)] (default: mid)")
+	fmt.Println("              (m={zstd_memory_limit})")
+	fmt.Println("              (crc[=on|off]) (checksum of frames, default: on)")
+	fmt.Println("              (lowmem[=on|off]) (use less memory, compress slower)")
+	fmt.Println("              (zeroframes[=on|off]) (write frame for empty input)")
+	fmt.Println("              (fcs[=on|off]) (write size of content to frame header)")
+	fmt.Println("              (auto)]")
+	fmt.Println("zstd_compression_level: [(low)(mid)(high)(best)({digit}+)] (default: mid)")
+	fmt.Println("  number is level 1..22 of reference zstd, it is mapped to the nearest of")
+	fmt.Println("  low (1-2), mid (3-5), high (6-9) and best (10-22)")
 	fmt.Println("zstd_threads_count: {digit}+ (default: 1) (0 means all cpu count)")
 	fmt.Println("zstd_memory_limit: {digit}+[GMKB%]")
 	fmt.Println("  in creating archive means window size (default: 70%)")
 	fmt.Println("  in reading archive means memory limit (default: 8G)")
+	fmt.Println("zstd_rule: {pattern}:l={zstd_compression_level}")
+	fmt.Println("  level of matching files, which are compressed separately by --entry-codec=zstd,")
+	fmt.Println("  the last matching rule wins")
 	fmt.Println()
 	fmt.Println("zstd_options example:")
-	fmt.Printf("  %s -cvf test.rpk.zst --zstd=t=4\n", exe)
+	fmt.Printf("  %s create -v -f test.rpk.zst --zstd=t=4\n", exe)
 	fmt.Println("    create archive 'test.rpk.zst', with ZSTD compression on 4 threads")
-	fmt.Printf("  %s -cvf test.rpk.zst --zstd=auto\n", exe)
+	fmt.Printf("  %s create -v -f test.rpk.zst --zstd=auto\n", exe)
 	fmt.Println("    or")
-	fmt.Printf("  %s -cvf test.rpk.zst --zstd\n", exe)
+	fmt.Printf("  %s create -v -f test.rpk.zst --zstd\n", exe)
 	fmt.Println("    create archive 'test.rpk.zst', with ZSTD compression with auto")
 	fmt.Println("    parameters detection (compressopn level, thread count, block size)")
-	fmt.Printf("  %s -xvf test.rpk.zst --zstd\n", exe)
+	fmt.Printf("  %s create -v -f test.rpk.zst --zstd=l=19,crc=off,fcs\n", exe)
+	fmt.Println("    create archive 'test.rpk.zst' with the best compression, without checksum,")
+	fmt.Println("    and with size of archive in frame header")
+	fmt.Printf("  %s create -v -f test.rpk --entry-codec=zstd --zstd='l=low;*.log:l=best'\n", exe)
+	fmt.Println("    compress files separately with low level, and '.log' files with the best")
+	fmt.Printf("  %s extract -v -f test.rpk.zst --zstd\n", exe)
 	fmt.Println("    unpack archive 'test.rpk.zst', with ZSTD (auto parameters)")
-	fmt.Printf("  %s -xvf test.rpk.zst\n", exe)
+	fmt.Printf("  %s extract -v -f test.rpk.zst\n", exe)
 	fmt.Println("    unpack archive 'test.rpk.zst', and maybe as ZSTD archive")
+}
+
+var commandExamples = map[string]func(exe string){
+	"create": func(exe string) {
+		fmt.Printf("  %s create -v -f test.rpk -e *.txt\n", exe)
+		fmt.Println("    create archive 'test.rpk', with all files in current directory")
+		fmt.Println("    without all '.txt' files")
+		fmt.Printf("  %s create -v -f test.rpk -d docs\n", exe)
+		fmt.Println("    create archive 'test.rpk', with all files in directory 'docs'")
+		fmt.Printf("  %s create -v -f test.rpk -e main.go *.go\n", exe)
+		fmt.Println("    create archive 'test.rpk', with all '.go' files in current directory")
+		fmt.Println("    without 'main.go' files")
+		fmt.Printf("  %s create -v -f test.rpk --exclude-vcs --gitignore\n", exe)
+		fmt.Println("    create archive 'test.rpk' without directory '.git' and files listed")
+		fmt.Println("    in '.gitignore' files, files listed in '.rpkignore' files are always excluded")
+		fmt.Printf("  %s create -v -f logs.rpk.zst --append -d /var/log/app *.log\n", exe)
+		fmt.Println("    append '.log' files to archive 'logs.rpk.zst', they are added as new segment")
+		fmt.Println("    compressed by the same codec, files of archive are not repacked, but they are")
+		fmt.Println("    decompressed to find end of archive, uncompressed archive is appended faster")
+		fmt.Printf("  git ls-files -z | %s create -v -f test.rpk -T - --null\n", exe)
+		fmt.Println("    create archive 'test.rpk' with files tracked by git, in order of list")
+		fmt.Printf("  pg_dump db | %s create -f dump.rpk --stdin-name dump.sql\n", exe)
+		fmt.Println("    create archive 'dump.rpk', with stdin stored as 'dump.sql'")
+		fmt.Printf("  %s create -f test.rpk --entry-codec=zstd --incompressible=entropy=7,saving=0.1\n", exe)
+		fmt.Println("    compress files separately, files with entropy of the first block above")
+		fmt.Println("    7 bits per byte, or which don't shrink by 10%, are stored as is")
+		fmt.Println()
+		printPatternHelp()
+		fmt.Println()
+		fmt.Println("size: {digit}+[GMK][B]")
+		fmt.Println("incompressible: {setting}(,{setting})*")
+		fmt.Println("setting: [(sample={size}) (default: 64K)")
+		fmt.Println("          (entropy={bits_per_byte}) (default: 7.5)")
+		fmt.Println("          (saving={part_of_size}) (default: 0.05)")
+		fmt.Println("          (nomagic)] (don't detect compressed formats by magic bytes)")
+	},
+	"extract": func(exe string) {
+		fmt.Printf("  %s extract -v -f test.rpk\n", exe)
+		fmt.Println("    extract files from archive 'test.rpk'")
+		fmt.Printf("  %s extract -v -f test.rpk -d tmp\n", exe)
+		fmt.Println("    extract files from archive 'test.rpk' to directory 'tmp'")
+	},
+	"list": func(exe string) {
+		fmt.Printf("  %s list -v -f test.rpk\n", exe)
+		fmt.Println("    show files in archive 'test.rpk'")
+		fmt.Printf("  %s list -f test.rpk --format=jsonl\n", exe)
+		fmt.Println("    print files in archive 'test.rpk' to stdout, one JSON object per line")
+	},
+	"test": func(exe string) {
+		fmt.Printf("  %s test -f test.rpk\n", exe)
+		fmt.Println("    check, that all files of archive 'test.rpk' can be read")
+	},
+	"cat": func(exe string) {
+		fmt.Printf("  %s cat -f test.rpk config/app.yml\n", exe)
+		fmt.Println("    write contents of 'config/app.yml' from archive 'test.rpk' to stdout")
+		fmt.Printf("  %s cat -f test.rpk --separator='==> {} <==\\n' *.log\n", exe)
+		fmt.Println("    write contents of all '.log' files to stdout, with names between them")
+		fmt.Println()
+		printPatternHelp()
+	},
+	"dict": func(exe string) {
+		fmt.Printf("  %s dict train -o json.dict -d samples *.json\n", exe)
+		fmt.Println("    train dictionary 'json.dict' from '.json' files in directory 'samples'")
+		fmt.Printf("  %s create -v -f test.rpk.zst --zstd --dict json.dict *.json\n", exe)
+		fmt.Println("    create archive 'test.rpk.zst' compressed with dictionary 'json.dict',")
+		fmt.Println("    dictionary is stored in archive, so it is not needed for extraction")
+	},
+	"bench": func(exe string) {
+		fmt.Printf("  %s bench -v -d data\n", exe)
+		fmt.Println("    measure codecs and ZSTD parameters on up to 32M of files in directory 'data',")
+		fmt.Println("    and recommend value of --zstd=")
+		fmt.Printf("  %s bench -d data --codecs=zstd --levels=mid,high --threads=4 --min-speed=50M *.log\n", exe)
+		fmt.Println("    measure only ZSTD on '.log' files, recommend the best ratio with 50M/s")
+		fmt.Println()
+		fmt.Println("list: {value}(,{value})*")
+		fmt.Println("size: {digit}+[GMK][B]")
+	},
+	"delete": func(exe string) {
+		fmt.Printf("  %s delete -v -f test.rpk.zst config/secret.env '*.key'\n", exe)
+		fmt.Println("    remove 'config/secret.env' and all '.key' files from archive 'test.rpk.zst',")
+		fmt.Println("    archive is written to temporary file, which replaces it")
+		fmt.Println()
+		printPatternHelp()
+	},
+	"rename": func(exe string) {
+		fmt.Printf("  %s rename -f test.rpk docs/readme.txt README\n", exe)
+		fmt.Println("    rename file 'docs/readme.txt' in archive 'test.rpk' to 'README'")
+		fmt.Printf("  %s rename -f test.rpk docs manual\n", exe)
+		fmt.Println("    move all files of directory 'docs' to directory 'manual'")
+	},
+	"serve": func(exe string) {
+		fmt.Printf("  %s serve -f test.rpk --listen 127.0.0.1:8080\n", exe)
+		fmt.Println("    browse and download files of archive 'test.rpk' at http://127.0.0.1:8080/files/,")
+		fmt.Println("    file table is available as JSON at http://127.0.0.1:8080/api/files")
+	},
+}
+
+func (cmd *command) help() {
+	exe := filepath.Base(os.Args[0])
+	fmt.Printf("%s %s: %s\n", exe, cmd.name, cmd.summary)
+	fmt.Printf("usage: %s %s [options...]", exe, cmd.name)
+	if len(cmd.args) > 0 {
+		fmt.Printf(" %s", cmd.args)
+	}
+	fmt.Println()
+	cmd.newFlagSet(&config{}).printOptions(os.Stdout)
+	if examples, ok := commandExamples[cmd.name]; ok {
+		fmt.Println()
+		fmt.Println("examples:")
+		examples(exe)
+	}
 	os.Exit(0)
 }
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+
+	"github.com/egor9814/rawpack"
+)
+
+// openIndex opens archive for random access,
+// returns nil if archive is not seekable or compressed
+func openIndex(name string, opts rawpack.Options) (*rawpack.ReaderAt, io.Closer, error) {
+	if isStdIOFile(name) {
+		return nil, nil, nil
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		handleClosing(f, name)
+		return nil, nil, err
+	}
+	if !info.Mode().IsRegular() {
+		handleClosing(f, name)
+		return nil, nil, nil
+	}
+
+	ra, err := rawpack.OpenReaderAt(f, info.Size(), opts)
+	if err != nil {
+		handleClosing(f, name)
+		if errors.Is(err, rawpack.ErrNotSeekable) {
+			err = nil
+		}
+		return nil, nil, err
+	}
+	return ra, f, nil
+}
+
+// archiveCloser closes reader of archive (decompressor) and then its file
+type archiveCloser struct {
+	archive *rawpack.Reader
+	file    io.Closer
+}
+
+func (c *archiveCloser) Close() error {
+	err := c.archive.Close()
+	if c.file != nil {
+		if e := c.file.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// openArchive opens archive for sequential reading and reads its file table,
+// returned closer closes both reader of archive and file
+func openArchive(name string, opts rawpack.Options) (*rawpack.Reader, rawpack.FileTable, io.Closer, error) {
+	r, c, err := openFileForRead(name)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	archive, ft, err := rawpack.OpenReader(r, opts)
+	if err != nil {
+		handleClosing(c, name)
+		return nil, nil, nil, err
+	}
+	return archive, ft, &archiveCloser{archive: archive, file: c}, nil
+}
+
+// readSegments skips files of archive opened by openArchive, and returns file tables of all its segments,
+// appended segments are found only after files of previous ones
+func readSegments(ctx context.Context, archive *rawpack.Reader, ft rawpack.FileTable, buf []byte) (rawpack.FileTable, error) {
+	all := ft
+	var err error
+	for err == nil {
+		for i := range ft {
+			if _, err := io.CopyBuffer(io.Discard, &contextReader{ctx: ctx, name: ft[i].Name, r: archive.ReadFile(&ft[i])}, buf); err != nil {
+				return nil, err
+			}
+		}
+		if ft, err = archive.NextFileTable(); err == nil {
+			all = append(all, ft...)
+		}
+	}
+	if err != io.EOF {
+		return nil, err
+	}
+	return all, nil
+}
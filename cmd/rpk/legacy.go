@@ -0,0 +1,160 @@
+package main
+
+import "strings"
+
+// legacyArgs converts classic arguments, like '-cvf test.rpk *.go', to command arguments.
+// Options with values take following non-option arguments in order of options,
+// arguments after '--' are not options. Unknown options are usage errors.
+func legacyArgs(args []string) ([]string, error) {
+	var create, appendTo, list, extract bool
+	flags := make([][]string, 0, 8)
+	files := make([]string, 0, 2)
+	waiters := make([]string, 0, 4)
+	waitersRead := 0
+	handleArg := func(r rune) bool {
+		switch r {
+		default:
+			return false
+
+		case 'l':
+			list = true
+
+		case 'c':
+			create = true
+
+		case 'x':
+			extract = true
+
+		case 'r':
+			appendTo = true
+
+		case 'f', 'd', 'e', 'p', 'j':
+			waiters = append(waiters, "-"+string(r))
+
+		case 'v':
+			flags = append(flags, []string{"-v"})
+
+		case 'V':
+			version()
+
+		case 'h':
+			help()
+		}
+		return true
+	}
+	for i, arg := range args {
+		if arg == "--" {
+			for _, it := range args[i+1:] {
+				if waitersRead < len(waiters) {
+					flags = append(flags, []string{waiters[waitersRead], it})
+					waitersRead++
+				} else {
+					files = append(files, it)
+				}
+			}
+			break
+		}
+		switch arg {
+		case "--list":
+			handleArg('l')
+
+		case "--create":
+			handleArg('c')
+
+		case "--extract":
+			handleArg('x')
+
+		case "--append":
+			handleArg('r')
+
+		case "--file":
+			handleArg('f')
+
+		case "--dir":
+			handleArg('d')
+
+		case "--exclude":
+			handleArg('e')
+
+		case "--password":
+			handleArg('p')
+
+		case "--jobs":
+			handleArg('j')
+
+		case "--read-ahead", "--stdin-name":
+			waiters = append(waiters, arg)
+
+		case "--verbose":
+			handleArg('v')
+
+		case "--version":
+			handleArg('V')
+
+		case "--help":
+			handleArg('h')
+
+		default:
+			if arg == "--zstd" || strings.HasPrefix(arg, "--zstd=") || strings.HasPrefix(arg, "--format=") {
+				flags = append(flags, []string{arg})
+			} else if strings.HasPrefix(arg, "--") {
+				return nil, newUsageError("unknown flag %q", arg)
+			} else if len(arg) > 1 && arg[0] == '-' {
+				for _, r := range arg[1:] {
+					if !handleArg(r) {
+						return nil, newUsageError("unknown flag '-%c' in %q", r, arg)
+					}
+				}
+			} else if waitersRead < len(waiters) {
+				flags = append(flags, []string{waiters[waitersRead], arg})
+				waitersRead++
+			} else {
+				files = append(files, arg)
+			}
+		}
+	}
+	if waitersRead < len(waiters) {
+		return nil, newUsageError("not enough arguments for options %s", strings.Join(waiters[waitersRead:], ", "))
+	}
+
+	var cmd *command
+	switch {
+	case btoi(list)+btoi(extract)+btoi(create || appendTo) > 1:
+		return nil, newUsageError("only one of options -c (-r), -x and -l may be specified")
+	case list:
+		cmd = findCommand("list")
+	case extract:
+		cmd = findCommand("extract")
+	case create, appendTo:
+		cmd = findCommand("create")
+	default:
+		return nil, newUsageError("command not specified")
+	}
+
+	// options, which are not supported by command, are ignored as before
+	fs := cmd.newFlagSet(&config{})
+	result := []string{cmd.name}
+	if appendTo && cmd.name == "create" {
+		result = append(result, "--append")
+	}
+	for _, it := range flags {
+		name, _, _ := strings.Cut(strings.TrimLeft(it[0], "-"), "=")
+		if fs.Lookup(name) != nil {
+			result = append(result, it...)
+		}
+	}
+	if cmd.name == "create" {
+		result = append(result, "--")
+		result = append(result, files...)
+	} else if len(files) > 0 {
+		return nil, newUsageError("unexpected arguments %q", files)
+	}
+	return result, nil
+}
+
+func btoi(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestLegacyArgs(t *testing.T) {
+	tests := []struct {
+		args []string
+		want []string
+	}{
+		{[]string{"-cvf", "a.rpk", "b"}, []string{"create", "-v", "-f", "a.rpk", "--", "b"}},
+		// values are taken by options in order of options
+		{[]string{"-cvfe", "a.rpk", "b"}, []string{"create", "-v", "-f", "a.rpk", "-e", "b", "--"}},
+		{[]string{"-cfe", "a.rpk", "b", "c", "d"}, []string{"create", "-f", "a.rpk", "-e", "b", "--", "c", "d"}},
+		{[]string{"-c", "-f", "a.rpk", "--zstd=l=best", "x"}, []string{"create", "-f", "a.rpk", "--zstd=l=best", "--", "x"}},
+		{[]string{"-rf", "a.rpk", "x"}, []string{"create", "--append", "-f", "a.rpk", "--", "x"}},
+		{[]string{"-xf", "a.rpk", "-d", "out", "-j", "2"}, []string{"extract", "-f", "a.rpk", "-d", "out", "-j", "2"}},
+		{[]string{"--list", "--file", "a.rpk", "--format=json"}, []string{"list", "-f", "a.rpk", "--format=json"}},
+		// arguments after '--' are values and names of files
+		{[]string{"-cf", "--", "-a.rpk", "-v"}, []string{"create", "-f", "-a.rpk", "--", "-v"}},
+		{[]string{"-c", "--", "-f"}, []string{"create", "--", "-f"}},
+		// options, which are not supported by command, are skipped
+		{[]string{"-xf", "a.rpk", "--stdin-name", "x"}, []string{"extract", "-f", "a.rpk"}},
+	}
+	for _, tt := range tests {
+		got, err := legacyArgs(tt.args)
+		if err != nil {
+			t.Errorf("legacyArgs(%q): %v", tt.args, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("legacyArgs(%q) = %q, want %q", tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestLegacyArgsErrors(t *testing.T) {
+	for _, args := range [][]string{
+		{"-cvk", "a.rpk"},
+		{"-c", "--unknown"},
+		{"-cf"},
+		{"-cfe", "a.rpk"},
+		{"-xcf", "a.rpk"},
+		{"-lxf", "a.rpk"},
+		{"-v"},
+		{"-xf", "a.rpk", "b"},
+	} {
+		_, err := legacyArgs(args)
+		var ue usageError
+		if !errors.As(err, &ue) {
+			t.Errorf("legacyArgs(%q): got %v, want usage error", args, err)
+		}
+	}
+}
@@ -1,154 +1,45 @@
 package main
 
 import (
+	"context"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 )
 
 func main() {
-	if len(os.Args) < 2 {
+	args := os.Args[1:]
+	if len(args) == 0 {
 		noMode()
 	}
 
-	if d, err := os.Getwd(); err != nil {
-		handleCommand(err)
-	} else {
-		wd = d
-	}
-
-	var create, list, extract, verbose bool
-	var name, password string
-	excludes := make([]string, 0, 2)
-	files := make([]string, 0, 2)
-	waiters := make([]*string, 0, 4)
-	waitersReed := 0
-	var zstd *zstdInfo
-	handleArg := func(r rune) bool {
-		switch r {
-		default:
-			return false
-
-		case 'l':
-			list = true
-
-		case 'c':
-			create = true
-
-		case 'x':
-			extract = true
-
-		case 'f':
-			waiters = append(waiters, &name)
-
-		case 'd':
-			waiters = append(waiters, &wd)
-
-		case 'e':
-			l := len(excludes)
-			excludes = append(excludes, "")
-			waiters = append(waiters, &excludes[l])
+	switch args[0] {
+	case "-h", "--help":
+		help()
 
-		case 'p':
-			waiters = append(waiters, &password)
-
-		case 'v':
-			verbose = true
-
-		case 'V':
-			version()
-
-		case 'h':
-			help()
-		}
-		return true
+	case "-V", "--version":
+		version()
 	}
-	for i := 1; i < len(os.Args); i++ {
-		switch arg := os.Args[i]; arg {
-		case "-l", "--list":
-			handleArg('l')
-
-		case "-c", "--create":
-			handleArg('c')
-
-		case "-x", "--extract":
-			handleArg('x')
-
-		case "-f", "--file":
-			handleArg('f')
-
-		case "-d", "--dir":
-			handleArg('d')
-
-		case "-e", "--exclude":
-			handleArg('e')
-
-		case "-p", "--password":
-			waiters = append(waiters, &password)
-
-		case "-v", "--verbose":
-			handleArg('v')
-
-		case "--zstd":
-			zstd, _ = handleZstd("")
-
-		case "-V", "--version":
-			handleArg('V')
-
-		case "-h", "--help":
-			handleArg('h')
-
-		default:
-			if len(arg) == 0 {
-				panic("empty argument")
-			}
-			if strings.HasPrefix(arg, "--zstd=") {
-				if i, err := handleZstd(arg[7:]); err != nil {
-					logf("zstd format error: %v", err)
-					os.Exit(1)
-				} else {
-					zstd = i
-				}
-			} else if arg[0] == '-' {
-				handled := 0
-				for _, r := range arg[1:] {
-					if handleArg(r) {
-						handled++
-					} else {
-						logf("warning: ignoring unsupported flag '-%v'\n", string(r))
-					}
-				}
-				if handled == 0 {
-					logf("warning: ignoring unsupported flag '%s'\n", arg)
-				}
-			} else if waitersReed < len(waiters) {
-				*waiters[waitersReed] = arg
-				waitersReed++
-			} else {
-				files = append(files, arg)
-			}
+	if strings.HasPrefix(args[0], "-") {
+		var err error
+		if args, err = legacyArgs(args); err != nil {
+			handleCommand(err)
 		}
 	}
-	if waitersReed < len(waiters) {
-		logln("error: not enough arguments for provided options")
-		os.Exit(1)
-	}
 
-	if list {
-		handleCommand(listArchive(name, password, zstd, verbose))
-		return
+	cmd := findCommand(args[0])
+	if cmd == nil {
+		handleCommand(newUsageError("unknown command %q", args[0]))
 	}
 
-	if extract {
-		handleCommand(unpackArchive(name, password, zstd, verbose))
-		return
-	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		// the next signal terminates immediately
+		<-ctx.Done()
+		stop()
+	}()
 
-	if !create {
-		noMode()
-	}
-
-	if len(files) == 0 {
-		files = append(files, "*")
-	}
-	handleCommand(packArchive(name, password, files, excludes, zstd, verbose))
+	handleCommand(cmd.exec(ctx, args[1:]))
 }
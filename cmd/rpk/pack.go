@@ -1,96 +1,81 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+
 	"github.com/egor9814/rawpack"
-	"io"
 )
 
-func packFile(out io.Writer, f *rawpack.File, buf []byte, verbose bool) error {
-	rc, err := f.Read()
-	if err != nil {
-		return err
-	}
-	defer handleClosing(rc, f.Name)
-	_, err = copyBuffer(out, rc, f.Size, buf, verbose)
-	return err
-}
-
-func packArchive(name, password string, files, excludes []string, zstd *zstdInfo, verbose bool) error {
-	if verbose {
-		logln("scaning files...")
-	}
-	ft, err := findFiles(files, excludes, verbose)
-	if err != nil {
-		return err
-	}
-	if len(ft) == 0 {
-		logln("\rwarning: files not specified, empty archive will be created")
+func packArchive(ctx context.Context, name, root string, opts rawpack.Options, appendTo, verbose bool) error {
+	if appendTo {
+		if isStdIOFile(name) {
+			return newUsageError("files cannot be appended to stdout")
+		}
+		// missing archive is created, so the first run of rolling archive needs no special case
+		if _, err := os.Stat(name); err == nil {
+			return appendArchive(ctx, name, root, opts, verbose)
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
 	}
-
 	if verbose {
-		log("\rcreating archive")
+		log("creating archive")
 		if !isStdIOFile(name) {
 			logf(" %q", name)
 		}
 		logln("...")
 	}
 
-	w, c, err := openFileForWrite(name)
-	if err != nil {
-		return err
+	// parameters measured on this machine are not used for reproducible archive
+	if !opts.Reproducible {
+		dir := ""
+		if !isStdIOFile(name) {
+			dir = filepath.Dir(name)
+		}
+		opts.BufferSize, opts.WriteSpeed = tuneIO(dir, uint64(opts.BufferSize))
 	}
-	defer handleClosing(c, name)
 
-	if err := chdir(); err != nil {
-		return err
+	w, f := openFileForWrite(name)
+	if f != nil {
+		defer handleClosing(f, name)
 	}
 
-	buf, writeSpeed, err := makeIOBuffer()
-	if err != nil {
+	pl := newProgressLog("packed", verbose)
+	pl.warnEmpty = true
+	opts.Progress = pl
+	if err := rawpack.PackDir(ctx, w, root, opts); err != nil {
+		if f != nil {
+			f.remove()
+		}
 		return err
 	}
+	pl.finish()
+	return nil
+}
 
-	fileSize := uint64(len(rawpack.Signature{}))
-	for _, it := range ft {
-		fileSize += it.Size + uint64(len([]byte(it.Name)))
-	}
-	fileSize += uint64(len(ft)) * 8
-
-	w, c, err = zstd.wrapWriter(w, writeSpeed, fileSize)
-	if err != nil {
-		return err
+func appendArchive(ctx context.Context, name, root string, opts rawpack.Options, verbose bool) error {
+	if verbose {
+		logf("appending to archive %q...\n", name)
 	}
-	defer handleClosing(c, "ZSTD Compressor")
-
-	if len(password) > 0 {
-		w = newCryptoWriter(w, []byte(password))
+	if !opts.Reproducible {
+		opts.BufferSize, opts.WriteSpeed = tuneIO(filepath.Dir(name), uint64(opts.BufferSize))
 	}
 
-	archive := rawpack.NewWriter(w)
-	err = archive.WriteSignature(rawpack.NewSignature())
-	if err == nil {
-		err = archive.WriteFileTable(ft)
-	}
+	pl := newProgressLog("packed", verbose)
+	pl.warnEmpty = true
+	opts.Progress = pl
+	a, err := rawpack.OpenAppend(ctx, name, opts)
 	if err != nil {
 		return err
 	}
-
-	if verbose {
-		for i, it := range ft {
-			logf("\r%3d/%3d> packing %s...\n", i+1, len(ft), it.Name)
-			if err := packFile(archive, &it, buf, true); err != nil {
-				return err
-			}
-		}
-		logln("\rdone!                                            ")
-	} else {
-		for _, it := range ft {
-			logln(it.Name)
-			if err := packFile(archive, &it, buf, false); err != nil {
-				return err
-			}
-		}
+	defer handleClosing(a, name)
+	if err := a.PackDir(ctx, root); err != nil {
+		return err
 	}
-
+	pl.finish()
 	return nil
 }
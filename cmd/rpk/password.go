@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/egor9814/rawpack"
+)
+
+// promptPassword reads password from terminal without echo, and asks it twice if confirm is set
+func promptPassword(ctx context.Context, confirm bool) rawpack.PasswordSource {
+	return func() ([]byte, error) {
+		tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+		if err != nil {
+			return nil, fmt.Errorf("cannot open terminal for password prompt: %w", err)
+		}
+		defer tty.Close()
+
+		password, err := readPassword(ctx, tty, "password: ")
+		if err != nil || !confirm {
+			return password, err
+		}
+		again, err := readPassword(ctx, tty, "confirm password: ")
+		defer clear(again)
+		if err != nil {
+			clear(password)
+			return nil, err
+		}
+		if !bytes.Equal(password, again) {
+			clear(password)
+			return nil, errors.New("passwords do not match")
+		}
+		return password, nil
+	}
+}
+
+func readPassword(ctx context.Context, tty *os.File, prompt string) ([]byte, error) {
+	restore, err := disableEcho(tty)
+	if err != nil {
+		return nil, err
+	}
+	defer restore()
+	_, _ = fmt.Fprint(tty, prompt)
+	// newline typed by user is not echoed
+	defer fmt.Fprintln(tty)
+
+	type result struct {
+		password []byte
+		err      error
+	}
+	done := make(chan result, 1)
+	go func() {
+		password, err := rawpack.PasswordReader(lineReader{tty})()
+		done <- result{password, err}
+	}()
+	select {
+	case r := <-done:
+		return r.password, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// lineReader reads from terminal until end of line, because terminal does not report EOF after it
+type lineReader struct {
+	f *os.File
+}
+
+func (r lineReader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	n, err := r.f.Read(p[:1])
+	if n > 0 && p[0] == '\n' {
+		return n, io.EOF
+	}
+	return n, err
+}
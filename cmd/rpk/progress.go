@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/egor9814/rawpack"
+)
+
+const progressInterval = 100 * time.Millisecond
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+func formatBytes(n float64) string {
+	const units = "KMGTPE"
+	if n < 1024 {
+		return fmt.Sprintf("%.0f B", n)
+	}
+	i := -1
+	for n >= 1024 && i+1 < len(units) {
+		n /= 1024
+		i++
+	}
+	return fmt.Sprintf("%.1f %ciB", n, units[i])
+}
+
+func formatDuration(d time.Duration) string {
+	d = d.Round(time.Second)
+	h, m, s := int(d.Hours()), int(d.Minutes())%60, int(d.Seconds())%60
+	if h > 0 {
+		return fmt.Sprintf("%d:%02d:%02d", h, m, s)
+	}
+	return fmt.Sprintf("%02d:%02d", m, s)
+}
+
+// progressLog renders rawpack.Progress in verbose mode as progress bar if stderr is terminal,
+// and as plain lines otherwise. In non-verbose mode only names of files are printed.
+type progressLog struct {
+	mu         sync.Mutex
+	action     string
+	verbose    bool
+	warnEmpty  bool
+	tty        bool
+	files      int
+	totalBytes uint64
+	doneFiles  int
+	doneBytes  uint64
+	start      time.Time
+	lastDraw   time.Time
+	barShown   bool
+}
+
+func newProgressLog(action string, verbose bool) *progressLog {
+	return &progressLog{
+		action:  action,
+		verbose: verbose,
+		tty:     isTerminal(os.Stderr),
+		start:   time.Now(),
+	}
+}
+
+func (p *progressLog) Start(ft rawpack.FileTable) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(ft) == 0 && p.warnEmpty {
+		logln("warning: files not specified, empty archive will be created")
+	}
+	if p.files == 0 {
+		p.start = time.Now()
+	}
+	// segments of appended archive are started one after another
+	p.files += len(ft)
+	for _, it := range ft {
+		p.totalBytes += it.Size
+	}
+}
+
+func (p *progressLog) FileStart(f *rawpack.File) {
+	if !p.verbose {
+		p.mu.Lock()
+		logln(f.Name)
+		p.mu.Unlock()
+	}
+}
+
+func (p *progressLog) FileProgress(f *rawpack.File, n uint64) {
+	if !p.verbose {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.doneBytes += n
+	if p.tty && time.Since(p.lastDraw) >= progressInterval {
+		p.draw()
+	}
+}
+
+func (p *progressLog) FileDone(f *rawpack.File, err error) {
+	if !p.verbose {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err != nil {
+		return
+	}
+	p.doneFiles++
+	if !p.tty {
+		logf("%3d/%3d> %s %s (%d bytes)\n", p.doneFiles, p.files, p.action, f.Name, f.Size)
+	} else if time.Since(p.lastDraw) >= progressInterval {
+		p.draw()
+	}
+}
+
+func (p *progressLog) finish() {
+	if !p.verbose {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.tty {
+		p.clear()
+	}
+	elapsed := time.Since(p.start)
+	logf("done! %d files, %s in %s (%s/s)\n", p.doneFiles, formatBytes(float64(p.doneBytes)), formatDuration(elapsed), formatBytes(p.speed(elapsed)))
+}
+
+func (p *progressLog) speed(elapsed time.Duration) float64 {
+	if s := elapsed.Seconds(); s > 0 {
+		return float64(p.doneBytes) / s
+	}
+	return 0
+}
+
+func (p *progressLog) clear() {
+	if p.barShown {
+		log("\r\033[K")
+		p.barShown = false
+	}
+}
+
+func (p *progressLog) draw() {
+	const width = 30
+	p.lastDraw = time.Now()
+	ratio := 1.0
+	if p.totalBytes > 0 {
+		ratio = float64(p.doneBytes) / float64(p.totalBytes)
+	}
+	filled := int(ratio * width)
+	elapsed := time.Since(p.start)
+	speed := p.speed(elapsed)
+	eta := "--:--"
+	if speed > 0 {
+		eta = formatDuration(time.Duration(float64(p.totalBytes-p.doneBytes) / speed * float64(time.Second)))
+	}
+	logf(
+		"\r\033[K[%s%s] %3.0f%% %d/%d files %s/s ETA %s",
+		strings.Repeat("=", filled), strings.Repeat(" ", width-filled),
+		ratio*100, p.doneFiles, p.files, formatBytes(speed), eta,
+	)
+	p.barShown = true
+}
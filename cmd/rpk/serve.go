@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/egor9814/rawpack"
+)
+
+type archiveServer struct {
+	ra      *rawpack.ReaderAt
+	modTime time.Time
+	files   map[string]int
+	dirs    map[string][]string
+}
+
+func newArchiveServer(ra *rawpack.ReaderAt, modTime time.Time) *archiveServer {
+	s := &archiveServer{
+		ra:      ra,
+		modTime: modTime,
+		files:   make(map[string]int),
+		dirs:    make(map[string][]string),
+	}
+	children := make(map[string]map[string]bool)
+	add := func(dir, child string) {
+		if children[dir] == nil {
+			children[dir] = make(map[string]bool)
+		}
+		children[dir][child] = true
+	}
+	add("", "")
+	for i, it := range ra.FileTable() {
+		name := path.Clean("/" + it.Name)[1:]
+		s.files[name] = i
+		dir, file := path.Split(name)
+		add(strings.TrimSuffix(dir, "/"), file)
+		for len(dir) > 0 {
+			dir = strings.TrimSuffix(dir, "/")
+			parent, sub := path.Split(dir)
+			add(strings.TrimSuffix(parent, "/"), sub+"/")
+			dir = parent
+		}
+	}
+	for dir, it := range children {
+		list := make([]string, 0, len(it))
+		for child := range it {
+			if len(child) > 0 {
+				list = append(list, child)
+			}
+		}
+		sort.Strings(list)
+		s.dirs[dir] = list
+	}
+	return s
+}
+
+func (s *archiveServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	switch p := r.URL.Path; {
+	case p == "/":
+		http.Redirect(w, r, "/files/", http.StatusFound)
+
+	case p == "/api/files":
+		s.serveFileTable(w)
+
+	case strings.HasPrefix(p, "/files/"):
+		s.serveFile(w, r, p[len("/files/"):])
+
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *archiveServer) serveFileTable(w http.ResponseWriter) {
+	ft := s.ra.FileTable()
+	offsets := make([]int64, len(ft))
+	for i := range offsets {
+		offsets[i] = s.ra.Offset(i)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := writeFileTable(w, ft, offsets, jsonFormat); err != nil {
+		logf("error: cannot write file table: %v\n", err)
+	}
+}
+
+func (s *archiveServer) serveFile(w http.ResponseWriter, r *http.Request, name string) {
+	isDir := len(name) == 0 || strings.HasSuffix(name, "/")
+	name = strings.TrimSuffix(name, "/")
+	if i, ok := s.files[name]; ok && !isDir {
+		content, err := s.ra.OpenContent(i)
+		if errors.Is(err, rawpack.ErrNotSeekable) {
+			s.serveStream(w, r, i)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		http.ServeContent(w, r, path.Base(name), s.modTime, content)
+		return
+	}
+	list, ok := s.dirs[name]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	if !isDir {
+		http.Redirect(w, r, path.Base(name)+"/", http.StatusMovedPermanently)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	title := html.EscapeString("/" + name)
+	_, _ = fmt.Fprintf(w, "<!doctype html>\n<title>%s</title>\n<h1>%s</h1>\n<pre>\n", title, title)
+	if len(name) > 0 {
+		_, _ = fmt.Fprintln(w, `<a href="../">../</a>`)
+	}
+	for _, it := range list {
+		u := url.URL{Path: "./" + it}
+		_, _ = fmt.Fprintf(w, "<a href=\"%s\">%s</a>\n", u.EscapedPath(), html.EscapeString(it))
+	}
+	_, _ = fmt.Fprintln(w, "</pre>")
+}
+
+// serveStream writes file compressed separately, it is decompressed while it is sent,
+// so ranges are not supported
+func (s *archiveServer) serveStream(w http.ResponseWriter, r *http.Request, i int) {
+	f := &s.ra.FileTable()[i]
+	content, err := s.ra.OpenStream(i)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	ctype := mime.TypeByExtension(path.Ext(f.Name))
+	if len(ctype) == 0 {
+		ctype = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", ctype)
+	w.Header().Set("Content-Length", strconv.FormatUint(f.ContentSize(), 10))
+	w.Header().Set("Accept-Ranges", "none")
+	w.Header().Set("Last-Modified", s.modTime.UTC().Format(http.TimeFormat))
+	if r.Method == http.MethodHead {
+		return
+	}
+	if _, err := io.Copy(w, content); err != nil {
+		// headers are sent already, connection is closed by short body
+		logf("error: %v\n", err)
+	}
+}
+
+// serveArchive serves archive until cancellation of ctx, active requests are completed then
+func serveArchive(ctx context.Context, name, listen string, opts rawpack.Options) error {
+	ra, c, err := openIndex(name, opts)
+	if err != nil {
+		return err
+	}
+	if ra == nil {
+		return errors.New("serving requires uncompressed archive file")
+	}
+	defer handleClosing(c, name)
+
+	info, err := os.Stat(name)
+	if err != nil {
+		return err
+	}
+
+	srv := &http.Server{Addr: listen, Handler: newArchiveServer(ra, info.ModTime())}
+	shutdown := make(chan error, 1)
+	go func() {
+		<-ctx.Done()
+		// the next signal terminates immediately, if requests are not completed
+		shutdown <- srv.Shutdown(context.Background())
+	}()
+	logf("serving %q on http://%s/\n", name, listen)
+	if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+	if err := <-shutdown; err != nil {
+		return err
+	}
+	return ctx.Err()
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+func disableEcho(f *os.File) (func(), error) {
+	return nil, errors.New("password prompt is not supported on this platform")
+}
@@ -1,23 +1,29 @@
 package main
 
 import (
-	"fmt"
-	"io"
+	"context"
+	"os"
 
 	"github.com/egor9814/rawpack"
 )
 
-func unpackFile(in io.Reader, f *rawpack.File, buf []byte, verbose bool) error {
-	wc, err := f.Write()
-	if err != nil {
-		return err
+func listFileTable(ft rawpack.FileTable, offsets []int64, format listFormat, verbose bool) error {
+	if format != textFormat {
+		return writeFileTable(os.Stdout, ft, offsets, format)
+	}
+	if verbose {
+		for i, it := range ft {
+			logf("%3d/%3d> %s (%d bytes)\n", i+1, len(ft), it.Name, it.ContentSize())
+		}
+	} else {
+		for _, it := range ft {
+			logln(it.Name)
+		}
 	}
-	defer handleClosing(wc, f.Name)
-	_, err = copyBuffer(wc, in, f.Size, buf, verbose)
-	return err
+	return nil
 }
 
-func readArchive(name, password string, list bool, zstd *zstdInfo, verbose bool) error {
+func readArchive(ctx context.Context, name, dir string, list bool, opts rawpack.Options, format listFormat, verbose bool) error {
 	if verbose {
 		if list {
 			log("list of files")
@@ -30,10 +36,36 @@ func readArchive(name, password string, list bool, zstd *zstdInfo, verbose bool)
 		logln("...")
 	}
 
-	buf, writeSpeed, err := makeIOBuffer()
-	if err != nil {
-		return err
+	if list {
+		ra, c, err := openIndex(name, opts)
+		if err != nil {
+			return err
+		}
+		if ra != nil {
+			defer handleClosing(c, name)
+			ft := ra.FileTable()
+			offsets := make([]int64, len(ft))
+			for i := range offsets {
+				offsets[i] = ra.Offset(i)
+			}
+			return listFileTable(ft, offsets, format, verbose)
+		}
+
+		archive, ft, c, err := openArchive(name, opts)
+		if err != nil {
+			return err
+		}
+		defer handleClosing(c, name)
+		if ft, err = readSegments(ctx, archive, ft, make([]byte, catBufferSize)); err != nil {
+			return err
+		}
+		return listFileTable(ft, nil, format, verbose)
+	}
+
+	if len(dir) == 0 {
+		dir = "."
 	}
+	opts.BufferSize, opts.WriteSpeed = tuneIO(dir, uint64(opts.BufferSize))
 
 	r, c, err := openFileForRead(name)
 	if err != nil {
@@ -41,68 +73,43 @@ func readArchive(name, password string, list bool, zstd *zstdInfo, verbose bool)
 	}
 	defer handleClosing(c, name)
 
-	r, err = zstd.wrapReader(r, writeSpeed)
-	if err != nil {
+	pl := newProgressLog("unpacked", verbose)
+	opts.Progress = pl
+	if err := rawpack.Extract(ctx, r, dir, opts); err != nil {
 		return err
 	}
+	pl.finish()
+	return nil
+}
 
-	if len(password) > 0 {
-		r = newCryptoReader(r, []byte(password))
-	}
+func listArchive(ctx context.Context, name string, opts rawpack.Options, format listFormat, verbose bool) error {
+	return readArchive(ctx, name, "", true, opts, format, verbose)
+}
 
-	archive := rawpack.NewReader(r)
-	s, err := archive.ReadSignature()
-	if err != nil {
-		return err
-	}
-	if !s.IsValid() {
-		return fmt.Errorf("invalid rawpack signature (maybe incorrect cryptoKey): %q", string(s[:]))
+func unpackArchive(ctx context.Context, name, dir string, opts rawpack.Options, verbose bool) error {
+	return readArchive(ctx, name, dir, false, opts, textFormat, verbose)
+}
+
+func testArchive(ctx context.Context, name string, opts rawpack.Options, verbose bool) error {
+	if verbose {
+		log("testing archive")
+		if !isStdIOFile(name) {
+			logf(" %q", name)
+		}
+		logln("...")
 	}
 
-	ft, err := archive.ReadFileTable()
+	r, c, err := openFileForRead(name)
 	if err != nil {
 		return err
 	}
+	defer handleClosing(c, name)
 
-	if list {
-		if verbose {
-			for i, it := range ft {
-				logf("%3d/%3d> %s (%d bytes)\n", i+1, len(ft), it.Name, it.Size)
-			}
-		} else {
-			for _, it := range ft {
-				logln(it)
-			}
-		}
-	} else {
-		if err := chdir(); err != nil {
-			return err
-		}
-		if verbose {
-			for i, it := range ft {
-				logf("\r%3d/%3d> unpacking %s...\n", i+1, len(ft), it.Name)
-				if err := unpackFile(archive, &it, buf, true); err != nil {
-					return err
-				}
-			}
-			logln("\rdone!                                            ")
-		} else {
-			for _, it := range ft {
-				logln(it.Name)
-				if err := unpackFile(archive, &it, buf, false); err != nil {
-					return err
-				}
-			}
-		}
+	pl := newProgressLog("tested", verbose)
+	opts.Progress = pl
+	if err := rawpack.Verify(ctx, r, opts); err != nil {
+		return err
 	}
-
+	pl.finish()
 	return nil
 }
-
-func listArchive(name, password string, zstd *zstdInfo, verbose bool) error {
-	return readArchive(name, password, true, zstd, verbose)
-}
-
-func unpackArchive(name, password string, zstd *zstdInfo, verbose bool) error {
-	return readArchive(name, password, false, zstd, verbose)
-}
@@ -0,0 +1,150 @@
+package rawpack
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/flate"
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/s2"
+)
+
+// Codec is compression of whole archive stream
+type Codec byte
+
+const (
+	// CodecNone means uncompressed archive, or detection of compression by magic bytes when reading
+	CodecNone Codec = iota
+	CodecZstd
+	CodecGzip
+	CodecS2
+	CodecSnappy
+	// CodecFlate is raw DEFLATE stream, it has no magic bytes and is not detected
+	CodecFlate
+	// CodecXz is only detected, xz compression is not supported
+	CodecXz
+)
+
+var codecNames = []string{"none", "zstd", "gzip", "s2", "snappy", "flate", "xz"}
+
+var ErrUnsupportedCodec = errors.New("unsupported compression")
+
+var (
+	gzipMagic   = []byte{0x1f, 0x8b, 0x08}
+	s2Magic     = []byte("\xff\x06\x00\x00S2sTwO")
+	snappyMagic = []byte("\xff\x06\x00\x00sNaPpY")
+	xzMagic     = []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}
+)
+
+// ParseCodec parses name of codec
+func ParseCodec(s string) (Codec, error) {
+	for i, it := range codecNames {
+		if it == s {
+			return Codec(i), nil
+		}
+	}
+	return CodecNone, fmt.Errorf("unknown codec %q, expected one of: %s", s, codecNames)
+}
+
+func (c Codec) String() string {
+	if int(c) < len(codecNames) {
+		return codecNames[c]
+	}
+	return fmt.Sprintf("codec(%d)", byte(c))
+}
+
+// detectCodec detects compression by magic bytes at the start of stream
+func detectCodec(magic []byte) Codec {
+	switch {
+	case len(magic) >= 4 && (bytes.HasPrefix(magic, zstdMagic) || isSkippableFrame(magic)):
+		return CodecZstd
+	case bytes.HasPrefix(magic, gzipMagic):
+		return CodecGzip
+	case bytes.HasPrefix(magic, s2Magic):
+		return CodecS2
+	case bytes.HasPrefix(magic, snappyMagic):
+		return CodecSnappy
+	case bytes.HasPrefix(magic, xzMagic):
+		return CodecXz
+	default:
+		return CodecNone
+	}
+}
+
+// codec returns codec of created archive
+func (o *Options) codec() Codec {
+	if o.EntryCodec != CodecNone {
+		// Zstd contains parameters of files compressed separately
+		return CodecNone
+	}
+	if o.Zstd != nil {
+		return CodecZstd
+	}
+	return o.Codec
+}
+
+// wrapWriter compresses w by codec of options, dictionary is used only by ZSTD
+func (o *Options) wrapWriter(w io.Writer, size uint64, dict []byte) (io.Writer, io.Closer, error) {
+	codec := o.codec()
+	switch codec {
+	case CodecNone:
+		return w, nil, nil
+	case CodecZstd:
+		z := o.Zstd
+		if z == nil {
+			z, _ = ParseZstdOptions("")
+		}
+		return z.wrapWriter(w, o.WriteSpeed, size, o.Reproducible, dict)
+	case CodecGzip:
+		gw, err := gzip.NewWriterLevel(w, gzip.DefaultCompression)
+		return gw, gw, err
+	case CodecS2:
+		sw := s2.NewWriter(w, s2.WriterConcurrency(o.jobs()))
+		return sw, sw, nil
+	case CodecSnappy:
+		sw := s2.NewWriter(w, s2.WriterSnappyCompat(), s2.WriterConcurrency(o.jobs()))
+		return sw, sw, nil
+	case CodecFlate:
+		fw, err := flate.NewWriter(w, flate.DefaultCompression)
+		return fw, fw, err
+	default:
+		return nil, nil, fmt.Errorf("%w: %s", ErrUnsupportedCodec, codec)
+	}
+}
+
+// wrapReader decompresses r by codec of options, or by codec detected by magic bytes,
+// ZSTD dictionary stored at the start of archive is returned
+func (o *Options) wrapReader(r io.Reader) (io.Reader, io.Closer, []byte, error) {
+	codec := o.codec()
+	if codec == CodecNone {
+		br := bufio.NewReader(r)
+		// error is detected later by reading of signature
+		magic, _ := br.Peek(len(s2Magic))
+		codec = detectCodec(magic)
+		r = br
+	}
+	switch codec {
+	case CodecNone:
+		return r, nil, nil, nil
+	case CodecZstd:
+		return o.Zstd.wrapReader(r, o.WriteSpeed)
+	case CodecGzip:
+		gr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		return gr, gr, nil, nil
+	case CodecS2, CodecSnappy:
+		return s2.NewReader(r), nil, nil, nil
+	case CodecFlate:
+		fr := flate.NewReader(r)
+		return fr, fr, nil, nil
+	case CodecXz:
+		return nil, nil, nil, fmt.Errorf("%w: %s, decompress archive with 'xz -d' first", ErrUnsupportedCodec, codec)
+	default:
+		return nil, nil, nil, fmt.Errorf("%w: %s", ErrUnsupportedCodec, codec)
+	}
+}
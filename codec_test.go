@@ -0,0 +1,99 @@
+package rawpack
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestDetectCodec(t *testing.T) {
+	skippable := []byte{0x50, 0x2a, 0x4d, 0x18, 0, 0, 0, 0}
+	tests := []struct {
+		name  string
+		magic []byte
+		want  Codec
+	}{
+		{"empty", nil, CodecNone},
+		{"rawpack", []byte(signaturePrefix), CodecNone},
+		{"zstd", append(bytes.Clone(zstdMagic), 0, 0), CodecZstd},
+		{"skippable frame", skippable, CodecZstd},
+		{"short zstd", zstdMagic[:3], CodecNone},
+		{"gzip", append(bytes.Clone(gzipMagic), 0), CodecGzip},
+		{"s2", s2Magic, CodecS2},
+		{"snappy", snappyMagic, CodecSnappy},
+		{"xz", xzMagic, CodecXz},
+		{"short s2", s2Magic[:6], CodecNone},
+	}
+	for _, tt := range tests {
+		if got := detectCodec(tt.magic); got != tt.want {
+			t.Errorf("%s: detectCodec = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseCodec(t *testing.T) {
+	for i, name := range codecNames {
+		c, err := ParseCodec(name)
+		if err != nil || c != Codec(i) || c.String() != name {
+			t.Errorf("ParseCodec(%q) = %s, %v", name, c, err)
+		}
+	}
+	if _, err := ParseCodec("lz4"); err == nil {
+		t.Error("ParseCodec of unknown codec succeeded")
+	}
+}
+
+func TestCodecRoundTrip(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, testFiles)
+	tests := []struct {
+		codec Codec
+		// detected is codec detected by magic bytes of archive
+		detected Codec
+	}{
+		{CodecZstd, CodecZstd},
+		{CodecGzip, CodecGzip},
+		{CodecS2, CodecS2},
+		{CodecSnappy, CodecSnappy},
+		{CodecFlate, CodecNone},
+	}
+	for _, tt := range tests {
+		ctx := context.Background()
+		var buf bytes.Buffer
+		if err := PackDir(ctx, &buf, root, Options{Codec: tt.codec}); err != nil {
+			t.Fatalf("%s: PackDir: %v", tt.codec, err)
+		}
+		if got := detectCodec(buf.Bytes()[:len(s2Magic)]); got != tt.detected {
+			t.Errorf("%s: detected codec %s", tt.codec, got)
+		}
+
+		// flate has no magic, so its codec is set for reading
+		read := Options{}
+		if tt.detected == CodecNone {
+			read.Codec = tt.codec
+		}
+		dest := t.TempDir()
+		if err := Extract(ctx, bytes.NewReader(buf.Bytes()), dest, read); err != nil {
+			t.Fatalf("%s: Extract: %v", tt.codec, err)
+		}
+		checkTree(t, dest, testFiles)
+		if err := Verify(ctx, bytes.NewReader(buf.Bytes()), read); err != nil {
+			t.Errorf("%s: Verify: %v", tt.codec, err)
+		}
+		if _, err := OpenReaderAt(bytes.NewReader(buf.Bytes()), int64(buf.Len()), read); !errors.Is(err, ErrNotSeekable) {
+			t.Errorf("%s: OpenReaderAt: %v, want ErrNotSeekable", tt.codec, err)
+		}
+	}
+}
+
+func TestCodecXz(t *testing.T) {
+	archive := append(bytes.Clone(xzMagic), make([]byte, 32)...)
+	if _, _, err := OpenReader(bytes.NewReader(archive), Options{}); !errors.Is(err, ErrUnsupportedCodec) {
+		t.Errorf("OpenReader of xz: %v, want ErrUnsupportedCodec", err)
+	}
+	var buf bytes.Buffer
+	if err := Pack(context.Background(), &buf, nil, Options{Codec: CodecXz}); !errors.Is(err, ErrUnsupportedCodec) {
+		t.Errorf("Pack with xz: %v, want ErrUnsupportedCodec", err)
+	}
+}
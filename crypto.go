@@ -0,0 +1,92 @@
+package rawpack
+
+import (
+	"crypto/md5"
+	"io"
+)
+
+type cryptoKey struct {
+	hash  [md5.Size]byte
+	index int
+}
+
+func (p *cryptoKey) reset(key *Key) {
+	p.index = 0
+	p.hash = key.hash
+}
+
+func (p *cryptoKey) apply(data []byte) {
+	for i, it := range data {
+		data[i] = it ^ p.hash[p.index]
+		p.index = (p.index + 1) % len(p.hash)
+	}
+}
+
+type cryptoWriter struct {
+	w io.Writer
+	k cryptoKey
+}
+
+func newCryptoWriter(out io.Writer, key *Key) (w *cryptoWriter) {
+	w = &cryptoWriter{
+		w: out,
+	}
+	w.k.reset(key)
+	return
+}
+
+// newCryptoWriterAt encrypts data written at offset of archive
+func newCryptoWriterAt(out io.Writer, key *Key, offset uint64) *cryptoWriter {
+	w := newCryptoWriter(out, key)
+	w.k.index = int(offset % uint64(len(w.k.hash)))
+	return w
+}
+
+func (w *cryptoWriter) Write(data []byte) (int, error) {
+	w.k.apply(data)
+	return w.w.Write(data)
+}
+
+type cryptoReader struct {
+	r io.Reader
+	k cryptoKey
+}
+
+func newCryptoReader(in io.Reader, key *Key) (r *cryptoReader) {
+	r = &cryptoReader{
+		r: in,
+	}
+	r.k.reset(key)
+	return
+}
+
+func (r *cryptoReader) Read(data []byte) (int, error) {
+	n, err := r.r.Read(data)
+	if n > 0 {
+		r.k.apply(data[:n])
+	}
+	return n, err
+}
+
+type cryptoReaderAt struct {
+	r io.ReaderAt
+	k cryptoKey
+}
+
+func newCryptoReaderAt(in io.ReaderAt, key *Key) (r *cryptoReaderAt) {
+	r = &cryptoReaderAt{
+		r: in,
+	}
+	r.k.reset(key)
+	return
+}
+
+func (r *cryptoReaderAt) ReadAt(data []byte, off int64) (int, error) {
+	n, err := r.r.ReadAt(data, off)
+	if n > 0 {
+		k := r.k
+		k.index = int(off % int64(len(k.hash)))
+		k.apply(data[:n])
+	}
+	return n, err
+}
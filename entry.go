@@ -0,0 +1,384 @@
+package rawpack
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sync"
+
+	"github.com/klauspost/compress/flate"
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/s2"
+	"github.com/klauspost/compress/zstd"
+)
+
+// ExtCodec is key of extension of file compressed separately (see Options.EntryCodec),
+// its value is size of data before compression (uint64) followed by name of codec
+const ExtCodec = "rpk.codec"
+
+const (
+	defaultSampleSize = 64 << 10 // 64KB
+	defaultMaxEntropy = 7.5
+	defaultMinSaving  = 0.05
+)
+
+// IncompressibleOptions configures detection of files, which are stored uncompressed with Options.EntryCodec.
+// Zero fields mean defaults.
+type IncompressibleOptions struct {
+	// SampleSize is size of the first block of file, which is checked (64KB by default)
+	SampleSize int
+	// MaxEntropy is entropy of sample in bits per byte (up to 8), above which file is stored (7.5 by default)
+	MaxEntropy float64
+	// MinSaving is part of size, which compression of sample and of whole file must save (0.05 by default)
+	MinSaving float64
+	// NoMagic disables detection of compressed formats (archives, images, media) by magic bytes
+	NoMagic bool
+}
+
+func (o IncompressibleOptions) withDefaults() IncompressibleOptions {
+	if o.SampleSize <= 0 {
+		o.SampleSize = defaultSampleSize
+	}
+	if o.MaxEntropy <= 0 {
+		o.MaxEntropy = defaultMaxEntropy
+	}
+	if o.MinSaving <= 0 {
+		o.MinSaving = defaultMinSaving
+	}
+	return o
+}
+
+// compressedMagics are magic bytes of compressed formats at their offsets
+var compressedMagics = []struct {
+	offset int
+	magic  []byte
+}{
+	{0, zstdMagic},
+	{0, gzipMagic},
+	{0, xzMagic},
+	{0, s2Magic},
+	{0, snappyMagic},
+	{0, []byte("BZh")},
+	{0, []byte{0x04, 0x22, 0x4d, 0x18}}, // lz4
+	{0, []byte("PK\x03\x04")},           // zip, jar, docx
+	{0, []byte("7z\xbc\xaf\x27\x1c")},
+	{0, []byte("Rar!\x1a\x07")},
+	{0, []byte("\x89PNG\r\n\x1a\n")},
+	{0, []byte{0xff, 0xd8, 0xff}}, // jpeg
+	{0, []byte("GIF8")},
+	{8, []byte("WEBP")},
+	{4, []byte("ftyp")},                 // mp4, mov, heic
+	{0, []byte{0x1a, 0x45, 0xdf, 0xa3}}, // mkv, webm
+	{0, []byte("OggS")},
+	{0, []byte("fLaC")},
+	{0, []byte("ID3")}, // mp3
+}
+
+func isCompressedFormat(b []byte) bool {
+	for _, it := range compressedMagics {
+		if len(b) >= it.offset && bytes.HasPrefix(b[it.offset:], it.magic) {
+			return true
+		}
+	}
+	return false
+}
+
+// entropy returns Shannon entropy of b in bits per byte
+func entropy(b []byte) float64 {
+	var counts [256]int
+	for _, it := range b {
+		counts[it]++
+	}
+	e := 0.0
+	for _, it := range counts {
+		if it > 0 {
+			p := float64(it) / float64(len(b))
+			e -= p * math.Log2(p)
+		}
+	}
+	return e
+}
+
+type countingWriter uint64
+
+func (w *countingWriter) Write(b []byte) (int, error) {
+	*w += countingWriter(len(b))
+	return len(b), nil
+}
+
+// newEntryWriter compresses file with name and size (-1 if it is unknown) by codec c,
+// z contains parameters of ZSTD and may be nil, dict is ZSTD dictionary of archive
+func newEntryWriter(c Codec, w io.Writer, z *ZstdOptions, dict []byte, name string, size int64) (io.WriteCloser, error) {
+	switch c {
+	case CodecZstd:
+		return z.entryWriter(w, dict, name, size)
+	case CodecGzip:
+		return gzip.NewWriterLevel(w, gzip.DefaultCompression)
+	case CodecS2:
+		return s2.NewWriter(w, s2.WriterConcurrency(1)), nil
+	case CodecSnappy:
+		return s2.NewWriter(w, s2.WriterSnappyCompat(), s2.WriterConcurrency(1)), nil
+	case CodecFlate:
+		return flate.NewWriter(w, flate.DefaultCompression)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedCodec, c)
+	}
+}
+
+func newEntryReader(c Codec, r io.Reader, dict []byte) (io.Reader, error) {
+	switch c {
+	case CodecZstd:
+		// single goroutine decoder doesn't need closing
+		options := []zstd.DOption{zstd.WithDecoderConcurrency(1)}
+		if dict != nil {
+			options = append(options, zstd.WithDecoderDicts(dict))
+		}
+		return zstd.NewReader(r, options...)
+	case CodecGzip:
+		return gzip.NewReader(r)
+	case CodecS2, CodecSnappy:
+		return s2.NewReader(r), nil
+	case CodecFlate:
+		return flate.NewReader(r), nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedCodec, c)
+	}
+}
+
+// compressible checks, whether sample of file shrinks with codec c
+func (o *IncompressibleOptions) compressible(sample []byte, c Codec, z *ZstdOptions, dict []byte, name string) (bool, error) {
+	if !o.NoMagic && isCompressedFormat(sample) {
+		return false, nil
+	}
+	if entropy(sample) > o.MaxEntropy {
+		return false, nil
+	}
+	var n countingWriter
+	w, err := newEntryWriter(c, &n, z, dict, name, -1)
+	if err != nil {
+		return false, err
+	}
+	if _, err := w.Write(sample); err != nil {
+		return false, err
+	}
+	if err := w.Close(); err != nil {
+		return false, err
+	}
+	return float64(n) <= float64(len(sample))*(1-o.MinSaving), nil
+}
+
+// EntryCodec returns codec of file compressed separately and size of its data before compression,
+// for other files CodecNone and Size are returned
+func (f *File) EntryCodec() (Codec, uint64, error) {
+	b, ok := f.Extension(ExtCodec)
+	if !ok {
+		return CodecNone, f.Size, nil
+	}
+	if len(b) < 8 {
+		return CodecNone, 0, fmt.Errorf("%s: invalid codec extension", f.Name)
+	}
+	c, err := ParseCodec(string(b[8:]))
+	if err != nil || c == CodecNone || c == CodecXz {
+		return CodecNone, 0, fmt.Errorf("%s: %w: %q", f.Name, ErrUnsupportedCodec, b[8:])
+	}
+	return c, binary.LittleEndian.Uint64(b), nil
+}
+
+// dataSize returns size of stored data after decompression
+func (f *File) dataSize() uint64 {
+	if _, n, err := f.EntryCodec(); err == nil {
+		return n
+	}
+	return f.Size
+}
+
+// compressEntry spools file compressed by codec, if it is compressible
+func compressEntry(ctx context.Context, f *File, c Codec, z *ZstdOptions, dict []byte, inc *IncompressibleOptions, sp *spooler) (err error) {
+	if f.Size == 0 {
+		return nil
+	}
+	rc, err := f.Read()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	in := &contextReader{ctx: ctx, name: f.Name, r: rc}
+
+	sample := make([]byte, min(f.Size, uint64(inc.SampleSize)))
+	if _, err := io.ReadFull(in, sample); err != nil {
+		return fmt.Errorf("%s: %w", f.Name, err)
+	}
+	if ok, err := inc.compressible(sample, c, z, dict, f.Name); err != nil || !ok {
+		return err
+	}
+
+	tmp, err := sp.create()
+	if err != nil {
+		return err
+	}
+	defer closeOnReturn(tmp, &err)
+	var n countingWriter
+	w, err := newEntryWriter(c, io.MultiWriter(tmp, &n), z, dict, f.Name, int64(f.Size))
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(sample); err != nil {
+		return err
+	}
+	if _, err := io.CopyN(w, in, int64(f.Size)-int64(len(sample))); err != nil {
+		if err == io.EOF {
+			err = errors.New("file is truncated while reading")
+		}
+		return fmt.Errorf("%s: %w", f.Name, err)
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	if float64(n) > float64(f.Size)*(1-inc.MinSaving) {
+		// file is stored as is
+		return os.Remove(tmp.Name())
+	}
+	value := binary.LittleEndian.AppendUint64(nil, f.Size)
+	f.SetExtension(ExtCodec, append(value, c.String()...))
+	f.Path = tmp.Name()
+	f.Size = uint64(n)
+	return nil
+}
+
+// compressEntries compresses compressible files of ft by opts.EntryCodec with ZSTD dictionary dict
+// in opts.Jobs goroutines
+func compressEntries(ctx context.Context, ft FileTable, opts *Options, dict []byte, sp *spooler) error {
+	w, err := newEntryWriter(opts.EntryCodec, io.Discard, opts.Zstd, dict, "", -1)
+	if err != nil {
+		return err
+	}
+	_ = w.Close()
+	inc := opts.Incompressible.withDefaults()
+	errs := make([]error, len(ft))
+	queue := make(chan int)
+	var wg sync.WaitGroup
+	for range opts.jobs() {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range queue {
+				errs[i] = compressEntry(ctx, &ft[i], opts.EntryCodec, opts.Zstd, dict, &inc, sp)
+			}
+		}()
+	}
+	for i := range ft {
+		if ctx.Err() != nil {
+			break
+		}
+		queue <- i
+	}
+	close(queue)
+	wg.Wait()
+	if err := checkContext(ctx, ""); err != nil {
+		return err
+	}
+	for _, it := range errs {
+		if it != nil {
+			return it
+		}
+	}
+	return nil
+}
+
+// progressReader reports bytes read from r as progress of f
+type progressReader struct {
+	r io.Reader
+	f *File
+	p Progress
+}
+
+func (r *progressReader) Read(b []byte) (int, error) {
+	n, err := r.r.Read(b)
+	if r.p != nil && n > 0 {
+		r.p.FileProgress(r.f, uint64(n))
+	}
+	return n, err
+}
+
+// copyEntry copies data of file f from in to dst like copyFile, file compressed separately is decompressed.
+// Progress is reported by stored bytes.
+func copyEntry(ctx context.Context, dst io.Writer, in io.Reader, f *File, buf []byte, p Progress) (err error) {
+	c, size, err := f.EntryCodec()
+	if err != nil {
+		return err
+	}
+	if c == CodecNone {
+		return copyFile(ctx, dst, in, f, buf, p)
+	}
+	if p != nil {
+		p.FileStart(f)
+		defer func() {
+			p.FileDone(f, err)
+		}()
+	}
+	stored := &progressReader{r: io.LimitReader(in, int64(f.Size)), f: f, p: p}
+	r, err := newEntryReader(c, stored, f.dict)
+	if err != nil {
+		return fmt.Errorf("%s: %w", f.Name, err)
+	}
+	data := *f
+	data.Size = size
+	sized := &entrySizeReader{r: r, f: f, left: size}
+	if err := copyFile(ctx, dst, sized, &data, buf, nil); err != nil {
+		return err
+	}
+	if _, err := sized.Read(buf[:1]); err != io.EOF {
+		return err
+	}
+	// end of compressed stream may be left unread by decompressor
+	_, err = io.CopyBuffer(io.Discard, stored, buf)
+	return err
+}
+
+// openEntry returns reader of data of file f from stored bytes of r, which must be read to the end
+func openEntry(r io.Reader, f *File) (io.Reader, error) {
+	c, size, err := f.EntryCodec()
+	if err != nil {
+		return nil, err
+	}
+	if c == CodecNone {
+		return io.LimitReader(r, int64(f.Size)), nil
+	}
+	dr, err := newEntryReader(c, io.LimitReader(r, int64(f.Size)), f.dict)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", f.Name, err)
+	}
+	return &entrySizeReader{r: dr, f: f, left: size}, nil
+}
+
+// entrySizeReader reads decompressed data of file f, which must have exactly size of codec extension
+type entrySizeReader struct {
+	r    io.Reader
+	f    *File
+	left uint64
+}
+
+func (r *entrySizeReader) Read(b []byte) (int, error) {
+	if r.left == 0 {
+		// decompressor must end with data
+		var probe [1]byte
+		if n, _ := r.r.Read(probe[:]); n > 0 {
+			return 0, fmt.Errorf("%s: decompressed data exceeds size %d", r.f.Name, r.f.dataSize())
+		}
+		return 0, io.EOF
+	}
+	b = b[:min(uint64(len(b)), r.left)]
+	n, err := r.r.Read(b)
+	r.left -= uint64(n)
+	if err == io.EOF && r.left > 0 {
+		err = fmt.Errorf("%s: decompressed data is shorter than size %d", r.f.Name, r.f.dataSize())
+	} else if err == io.EOF {
+		err = nil
+	}
+	return n, err
+}
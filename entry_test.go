@@ -0,0 +1,199 @@
+package rawpack
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// entryArchive returns uncompressed archive with file "a.txt" compressed separately by zstd,
+// its size in codec extension is replaced with size, if it is not 0
+func entryArchive(t *testing.T, content string, size uint64) *ReaderAt {
+	t.Helper()
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "a.txt"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := PackDir(context.Background(), &buf, root, Options{EntryCodec: CodecZstd}); err != nil {
+		t.Fatal(err)
+	}
+	ra, err := NewReaderAt(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c, _, err := ra.FileTable()[0].EntryCodec(); err != nil || c != CodecZstd {
+		t.Fatalf("file is not compressed: %v", err)
+	}
+	if size == 0 {
+		return ra
+	}
+
+	f := ra.FileTable()[0]
+	stored, err := io.ReadAll(ra.Open(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ext, _ := f.Extension(ExtCodec)
+	ext = bytes.Clone(ext)
+	binary.LittleEndian.PutUint64(ext, size)
+	f.Extensions = []Extension{{Key: ExtCodec, Value: ext}}
+	var crafted bytes.Buffer
+	w := NewWriter(&crafted)
+	ft := FileTable{f}
+	if err := w.WriteSignature(NewSignature().WithFlags(ft.flags())); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteFileTable(ft); err != nil {
+		t.Fatal(err)
+	}
+	crafted.Write(stored)
+	ra, err = NewReaderAt(bytes.NewReader(crafted.Bytes()), int64(crafted.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ra
+}
+
+func TestEntrySize(t *testing.T) {
+	content := strings.Repeat("compressible text\n", 1000)
+	tests := []struct {
+		name string
+		size uint64
+		ok   bool
+	}{
+		{"exact", 0, true},
+		{"shorter", uint64(len(content)) - 1, false},
+		{"longer", uint64(len(content)) + 1, false},
+		{"huge", 1 << 62, false},
+	}
+	for _, tt := range tests {
+		ra := entryArchive(t, content, tt.size)
+		if _, err := ra.OpenContent(0); !errors.Is(err, ErrNotSeekable) {
+			t.Errorf("%s: OpenContent: %v, want ErrNotSeekable", tt.name, err)
+		}
+		r, err := ra.OpenStream(0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := io.ReadAll(r)
+		if (err == nil) != tt.ok {
+			t.Errorf("%s: OpenStream: %v", tt.name, err)
+		}
+		if tt.ok && string(got) != content {
+			t.Errorf("%s: content differs", tt.name)
+		}
+
+		var out bytes.Buffer
+		err = copyEntry(context.Background(), &out, ra.Open(0), &ra.FileTable()[0], make([]byte, 4096), nil)
+		if (err == nil) != tt.ok {
+			t.Errorf("%s: copyEntry: %v", tt.name, err)
+		}
+	}
+}
+
+func TestEntryZstdDict(t *testing.T) {
+	files := make(map[string]string)
+	for i := range 64 {
+		files[fmt.Sprintf("r%02d.json", i)] = fmt.Sprintf(`{"id": %d, "name": "record %d", "tags": ["alpha", "beta", "gamma"], "enabled": %t, "comment": "%s"}`,
+			i, i, i%2 == 0, strings.Repeat("similar text of records ", 8+i%5))
+	}
+	more := map[string]string{"more.json": files["r00.json"]}
+	all := maps.Clone(files)
+	maps.Copy(all, more)
+	tests := map[string]*Key{
+		"plain":     nil,
+		"encrypted": NewKey([]byte("secret")),
+	}
+	for name, key := range tests {
+		ctx := context.Background()
+		root := t.TempDir()
+		writeTree(t, root, files)
+		p := filepath.Join(t.TempDir(), "a.rpk")
+		f, err := os.Create(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = PackDir(ctx, f, root, Options{EntryCodec: CodecZstd, TrainZstdDict: true, ZstdDictSize: 4 << 10, Key: key})
+		_ = f.Close()
+		if err != nil {
+			t.Fatalf("%s: PackDir: %v", name, err)
+		}
+
+		// files are compressed with dictionary stored before signature
+		a, err := OpenAppend(ctx, p, Options{EntryCodec: CodecZstd, Key: key})
+		if err != nil {
+			t.Fatalf("%s: OpenAppend: %v", name, err)
+		}
+		if a.seg.dict == nil || a.opts.Codec != CodecNone {
+			t.Errorf("%s: dictionary of uncompressed archive is not found", name)
+		}
+		root = t.TempDir()
+		writeTree(t, root, more)
+		if err := a.PackDir(ctx, root); err != nil {
+			t.Fatalf("%s: PackDir: %v", name, err)
+		}
+		if err := a.Close(); err != nil {
+			t.Fatal(err)
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ra, err := OpenReaderAt(bytes.NewReader(data), int64(len(data)), Options{Key: key})
+		if err != nil {
+			t.Fatalf("%s: OpenReaderAt: %v", name, err)
+		}
+		for i := range ra.FileTable() {
+			f := &ra.FileTable()[i]
+			if c, _, _ := f.EntryCodec(); c != CodecZstd {
+				t.Errorf("%s: %s is not compressed", name, f.Name)
+				continue
+			}
+			if _, err := io.Copy(io.Discard, ra.Open(i)); err != nil {
+				t.Fatal(err)
+			}
+			r, err := newEntryReader(CodecZstd, ra.Open(i), nil)
+			if err == nil {
+				_, err = io.Copy(io.Discard, r)
+			}
+			if err == nil {
+				t.Errorf("%s: %s is decompressed without dictionary", name, f.Name)
+			}
+		}
+
+		for _, jobs := range []int{1, 4} {
+			dest := t.TempDir()
+			if err := Extract(ctx, bytes.NewReader(data), dest, Options{Key: key, Jobs: jobs}); err != nil {
+				t.Fatalf("%s: Extract with %d jobs: %v", name, jobs, err)
+			}
+			checkTree(t, dest, all)
+		}
+		if err := Verify(ctx, bytes.NewReader(data), Options{Key: key}); err != nil {
+			t.Errorf("%s: Verify: %v", name, err)
+		}
+
+		var out bytes.Buffer
+		err = Rewrite(ctx, &out, bytes.NewReader(data), int64(len(data)), Options{Key: key}, func(f *File) (bool, error) {
+			return f.Name != "r00.json", nil
+		})
+		if err != nil {
+			t.Fatalf("%s: Rewrite: %v", name, err)
+		}
+		dest := t.TempDir()
+		if err := Extract(ctx, &out, dest, Options{Key: key}); err != nil {
+			t.Fatalf("%s: Extract of rewritten archive: %v", name, err)
+		}
+		delete(all, "r00.json")
+		checkTree(t, dest, all)
+		all["r00.json"] = files["r00.json"]
+	}
+}
@@ -0,0 +1,196 @@
+package rawpack
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// extractFile writes file to dest, incomplete file is removed on error.
+// Extended attributes are restored, if x is not nil.
+func extractFile(ctx context.Context, in io.Reader, f *File, dest string, buf []byte, p Progress, x *xattrFilter) (err error) {
+	name := filepath.FromSlash(f.Name)
+	if !filepath.IsLocal(name) {
+		return fmt.Errorf("unsafe file name %q", f.Name)
+	}
+	m, err := f.SparseMap()
+	if err != nil {
+		return err
+	}
+	out := *f
+	out.Path = filepath.Join(dest, name)
+	wc, err := out.Write()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = os.Remove(out.Path)
+		}
+	}()
+	defer closeOnReturn(wc, &err)
+	file := wc.(*os.File)
+	if m == nil {
+		err = copyEntry(ctx, wc, in, f, buf, p)
+	} else {
+		// holes are left by seeking over them, size of file is set after data
+		err = copyEntry(ctx, &sparseWriter{w: file, data: m.Data}, in, f, buf, p)
+		if err == nil {
+			err = file.Truncate(int64(m.Size))
+		}
+	}
+	if err == nil && x != nil {
+		err = x.restoreXattrs(f, file)
+	}
+	return err
+}
+
+// Extract writes files of archive from r to directory dest.
+// If r is a seekable and uncompressed file, files are written by opts.Jobs goroutines.
+// After cancellation of ctx, *CancelError is returned, files extracted before it are kept.
+func Extract(ctx context.Context, r io.Reader, dest string, opts Options) error {
+	if ra, ok := r.(io.ReaderAt); ok && opts.jobs() > 1 {
+		if s, ok := r.(io.Seeker); ok {
+			archive, err := openSeekable(ra, s, opts)
+			if err == nil {
+				return ExtractAt(ctx, archive, dest, opts)
+			} else if !errors.Is(err, ErrNotSeekable) {
+				return err
+			}
+		}
+	}
+
+	x, err := newXattrFilter(&opts)
+	if err != nil {
+		return err
+	}
+	archive, ft, err := OpenReader(r, opts)
+	if err != nil {
+		return err
+	}
+	defer archive.Close()
+	buf := opts.buffer()
+	for ; err == nil; ft, err = archive.NextFileTable() {
+		if opts.Progress != nil {
+			opts.Progress.Start(ft)
+		}
+		for i := range ft {
+			if err := checkContext(ctx, ""); err != nil {
+				return err
+			}
+			if err := extractFile(ctx, archive, &ft[i], dest, buf, opts.Progress, x); err != nil {
+				return err
+			}
+		}
+	}
+	if err != io.EOF {
+		return err
+	}
+	return nil
+}
+
+// openSeekable opens archive at current position of s, and restores the position,
+// returns ErrNotSeekable if s cannot seek (pipes) or archive is compressed
+func openSeekable(ra io.ReaderAt, s io.Seeker, opts Options) (*ReaderAt, error) {
+	start, err := s.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, ErrNotSeekable
+	}
+	end, err := s.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, ErrNotSeekable
+	}
+	if _, err := s.Seek(start, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return OpenReaderAt(io.NewSectionReader(ra, start, end-start), end-start, opts)
+}
+
+// makeDirs creates directories of files in table order, files with unsafe names are skipped,
+// they are reported by extractFile
+func makeDirs(ctx context.Context, ft FileTable, dest string) error {
+	made := make(map[string]bool)
+	for i := range ft {
+		name := filepath.FromSlash(ft[i].Name)
+		if !filepath.IsLocal(name) {
+			continue
+		}
+		dir := filepath.Dir(filepath.Join(dest, name))
+		if made[dir] {
+			continue
+		}
+		if err := checkContext(ctx, ""); err != nil {
+			return err
+		}
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+		made[dir] = true
+	}
+	return nil
+}
+
+// ExtractAt writes files of archive to directory dest by opts.Jobs goroutines.
+// Directories of files are created before files, errors of workers are returned in table order.
+func ExtractAt(ctx context.Context, ra *ReaderAt, dest string, opts Options) error {
+	x, err := newXattrFilter(&opts)
+	if err != nil {
+		return err
+	}
+	ft := ra.FileTable()
+	if err := makeDirs(ctx, ft, dest); err != nil {
+		return err
+	}
+	if opts.Progress != nil {
+		opts.Progress.Start(ft)
+	}
+	results := make([]chan error, len(ft))
+	for i := range results {
+		results[i] = make(chan error, 1)
+	}
+	queue := make(chan int)
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for range opts.jobs() {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			buf := opts.buffer()
+			for i := range queue {
+				results[i] <- extractFile(ctx, ra.Open(i), &ft[i], dest, buf, opts.Progress, x)
+			}
+		}()
+	}
+	go func() {
+		defer close(queue)
+		for i := range ft {
+			if ctx.Err() != nil {
+				return
+			}
+			select {
+			case queue <- i:
+			case <-stop:
+				return
+			}
+		}
+	}()
+	defer wg.Wait()
+	defer close(stop)
+
+	// results are collected in table order, so the first failed file is reported
+	for i := range ft {
+		select {
+		case err := <-results[i]:
+			if err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return checkContext(ctx, "")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package rawpack
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"maps"
+	"strings"
+	"testing"
+)
+
+func TestExtractAtParallel(t *testing.T) {
+	files := maps.Clone(testFiles)
+	for i := range 50 {
+		files[fmt.Sprintf("d%d/e%d/f%d.txt", i%5, i%7, i)] = strings.Repeat(fmt.Sprint(i), i*100)
+	}
+	root := t.TempDir()
+	writeTree(t, root, files)
+	var buf bytes.Buffer
+	if err := PackDir(context.Background(), &buf, root, Options{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// reader without ReaderAt is extracted serially
+	serial := t.TempDir()
+	if err := Extract(context.Background(), struct{ *bytes.Reader }{bytes.NewReader(buf.Bytes())}, serial, Options{}); err != nil {
+		t.Fatal(err)
+	}
+	checkTree(t, serial, files)
+
+	for _, jobs := range []int{1, 2, 8} {
+		ra, err := NewReaderAt(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		dest := t.TempDir()
+		if err := ExtractAt(context.Background(), ra, dest, Options{Jobs: jobs}); err != nil {
+			t.Fatalf("jobs %d: %v", jobs, err)
+		}
+		checkTree(t, dest, files)
+	}
+}
+
+func TestExtractAtUnsafeName(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	ft := FileTable{{Name: "a", Size: 1}, {Name: "../b", Size: 1}, {Name: "c", Size: 1}}
+	if err := w.WriteSignature(NewSignature()); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteFileTable(ft); err != nil {
+		t.Fatal(err)
+	}
+	buf.WriteString("abc")
+	ra, err := NewReaderAt(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dest := t.TempDir()
+	err = ExtractAt(context.Background(), ra, dest, Options{Jobs: 4})
+	if err == nil || !strings.Contains(err.Error(), "../b") {
+		t.Errorf("got %v, want error for unsafe name", err)
+	}
+}
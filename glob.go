@@ -0,0 +1,285 @@
+package rawpack
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// Pattern is compiled glob pattern of file names:
+//
+//	term    matches
+//	*       any characters except '/'
+//	**      any characters, when it is whole path segment ('**/', '/**/', '/**')
+//	?       any one character except '/'
+//	[a-z]   one character of class except '/', '[!a-z]' or '[^a-z]' negates class
+//	{a,b}   one of alternatives, which may contain other terms
+//	\c      character c as is
+//
+// Pattern without '/' matches base name of file in any directory.
+// Pattern starting with '!' is negation, see Matcher.
+type Pattern struct {
+	re     *regexp.Regexp
+	negate bool
+}
+
+// CompilePattern compiles glob pattern, ignoreCase enables case-insensitive matching
+func CompilePattern(pattern string, ignoreCase bool) (*Pattern, error) {
+	p := &Pattern{}
+	pattern = filepath.ToSlash(pattern)
+	if strings.HasPrefix(pattern, "!") {
+		p.negate = true
+		pattern = pattern[1:]
+	}
+	expr, err := globToRegexp(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+	}
+	if !strings.Contains(pattern, "/") {
+		expr = "(?:.*/)?" + expr
+	}
+	expr = "^" + expr + "$"
+	if ignoreCase {
+		expr = "(?i)" + expr
+	}
+	p.re, err = regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+	}
+	return p, nil
+}
+
+// Match reports whether name matches pattern, negation is not applied
+func (p *Pattern) Match(name string) bool {
+	return p.re.MatchString(name)
+}
+
+// Negated reports whether pattern starts with '!'
+func (p *Pattern) Negated() bool {
+	return p.negate
+}
+
+// Matcher is list of patterns, the last matching pattern decides, whether name is matched.
+// Names matching negated pattern are not matched, unless later pattern matches them again.
+// If the first pattern is negated, names matching no patterns are matched.
+type Matcher struct {
+	patterns []*Pattern
+}
+
+// CompilePatterns compiles list of glob patterns
+func CompilePatterns(patterns []string, ignoreCase bool) (*Matcher, error) {
+	m := &Matcher{patterns: make([]*Pattern, 0, len(patterns))}
+	for _, it := range patterns {
+		p, err := CompilePattern(it, ignoreCase)
+		if err != nil {
+			return nil, err
+		}
+		m.patterns = append(m.patterns, p)
+	}
+	return m, nil
+}
+
+// Empty reports whether matcher has no patterns
+func (m *Matcher) Empty() bool {
+	return len(m.patterns) == 0
+}
+
+// Match reports whether name is matched by list of patterns
+func (m *Matcher) Match(name string) bool {
+	if len(m.patterns) == 0 {
+		return false
+	}
+	matched := m.patterns[0].negate
+	for _, it := range m.patterns {
+		if matched == it.negate && it.Match(name) {
+			matched = !it.negate
+		}
+	}
+	return matched
+}
+
+// globToRegexp translates glob pattern to regular expression without anchors
+func globToRegexp(pattern string) (string, error) {
+	var sb strings.Builder
+	rest, err := translateGlob(&sb, pattern, 0, true)
+	if err != nil {
+		return "", err
+	}
+	if len(rest) > 0 {
+		return "", fmt.Errorf("unexpected '%c'", rest[0])
+	}
+	return sb.String(), nil
+}
+
+// translateGlob writes terms of pattern to sb until end of pattern, or ',' or '}' inside braces (depth > 0),
+// and returns the rest of pattern. segmentStart is set, if pattern starts path segment, it is set again after '/',
+// alternatives of braces start segment, only if braces do.
+func translateGlob(sb *strings.Builder, pattern string, depth int, segmentStart bool) (string, error) {
+	for len(pattern) > 0 {
+		c := pattern[0]
+		if c == '*' && segmentStart && strings.HasPrefix(pattern, "**") {
+			after := pattern[2:]
+			if strings.HasPrefix(after, "/") {
+				sb.WriteString("(?:.*/)?")
+				pattern = after[1:]
+				continue
+			}
+			if after == "" {
+				sb.WriteString(".*")
+				return after, nil
+			}
+		}
+		atStart := segmentStart
+		segmentStart = c == '/'
+		switch c {
+		case '*':
+			for len(pattern) > 0 && pattern[0] == '*' {
+				pattern = pattern[1:]
+			}
+			sb.WriteString("[^/]*")
+			continue
+
+		case '?':
+			sb.WriteString("[^/]")
+
+		case '[':
+			n, err := translateClass(sb, pattern)
+			if err != nil {
+				return "", err
+			}
+			pattern = pattern[n:]
+			continue
+
+		case '{':
+			sb.WriteString("(?:")
+			pattern = pattern[1:]
+			for {
+				var err error
+				pattern, err = translateGlob(sb, pattern, depth+1, atStart)
+				if err != nil {
+					return "", err
+				}
+				if len(pattern) == 0 {
+					return "", errors.New("unclosed '{'")
+				}
+				closing := pattern[0] == '}'
+				pattern = pattern[1:]
+				if closing {
+					break
+				}
+				sb.WriteByte('|')
+			}
+			sb.WriteByte(')')
+			continue
+
+		case ',', '}':
+			if depth > 0 {
+				return pattern, nil
+			}
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+
+		case '\\':
+			if len(pattern) < 2 {
+				return "", errors.New("trailing '\\'")
+			}
+			pattern = pattern[1:]
+			fallthrough
+
+		default:
+			_, n := utf8.DecodeRuneInString(pattern)
+			sb.WriteString(regexp.QuoteMeta(pattern[:n]))
+			pattern = pattern[n:]
+			continue
+		}
+		pattern = pattern[1:]
+	}
+	return pattern, nil
+}
+
+// translateClass writes character class from the start of pattern to sb, and returns its length.
+// Class never matches '/', like '?', so it is removed from positive class.
+func translateClass(sb *strings.Builder, pattern string) (int, error) {
+	i := 1
+	negate := i < len(pattern) && (pattern[i] == '!' || pattern[i] == '^')
+	if negate {
+		i++
+	}
+	// next returns rune at i and moves i after it, escaped rune is returned as is
+	next := func() rune {
+		if pattern[i] == '\\' && i+1 < len(pattern) {
+			i++
+		}
+		r, n := utf8.DecodeRuneInString(pattern[i:])
+		i += n
+		return r
+	}
+	// ranges of runes, single rune r is range r-r
+	var ranges [][2]rune
+	first := true
+	for i < len(pattern) {
+		switch {
+		case pattern[i] == ']' && !first:
+			return i + 1, writeClass(sb, ranges, negate)
+		case pattern[i] == '-' && !first && i+1 < len(pattern) && pattern[i+1] != ']':
+			i++
+			hi := next()
+			lo := ranges[len(ranges)-1][0]
+			if hi < lo {
+				return 0, fmt.Errorf("invalid range '%c-%c'", lo, hi)
+			}
+			ranges[len(ranges)-1][1] = hi
+		default:
+			r := next()
+			ranges = append(ranges, [2]rune{r, r})
+		}
+		first = false
+	}
+	return 0, errors.New("unclosed '['")
+}
+
+func writeClass(sb *strings.Builder, ranges [][2]rune, negate bool) error {
+	sb.WriteByte('[')
+	if negate {
+		sb.WriteString("^/")
+	}
+	empty := true
+	for _, r := range ranges {
+		if !negate && r[0] <= '/' && '/' <= r[1] {
+			// '/' is cut from range of positive class
+			if r[0] < '/' {
+				writeClassRange(sb, r[0], '/'-1)
+				empty = false
+			}
+			if r[1] > '/' {
+				writeClassRange(sb, '/'+1, r[1])
+				empty = false
+			}
+			continue
+		}
+		writeClassRange(sb, r[0], r[1])
+		empty = false
+	}
+	if empty {
+		return errors.New("class matches only '/'")
+	}
+	sb.WriteByte(']')
+	return nil
+}
+
+func writeClassRange(sb *strings.Builder, lo, hi rune) {
+	writeClassRune(sb, lo)
+	if hi != lo {
+		sb.WriteByte('-')
+		writeClassRune(sb, hi)
+	}
+}
+
+func writeClassRune(sb *strings.Builder, r rune) {
+	if strings.ContainsRune(`\[]^-`, r) {
+		sb.WriteByte('\\')
+	}
+	sb.WriteRune(r)
+}
@@ -0,0 +1,117 @@
+package rawpack
+
+import "testing"
+
+func TestPatternMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		match   bool
+	}{
+		{"*.go", "main.go", true},
+		{"*.go", "cmd/rpk/main.go", true},
+		{"*.go", "main.go.orig", false},
+		{"src/*.go", "src/a.go", true},
+		{"src/*.go", "src/sub/a.go", false},
+		{"src/**/*.go", "src/a.go", true},
+		{"src/**/*.go", "src/x/y/a.go", true},
+		{"src/**", "src/x/y/a.go", true},
+		{"**/a.go", "a.go", true},
+		{"a**b", "a/b", false},
+		{"file-?.txt", "file-1.txt", true},
+		{"file-?.txt", "file-12.txt", false},
+		{"a/?", "a//", false},
+		{"img-[0-9][0-9].png", "img-42.png", true},
+		{"img-[0-9][0-9].png", "img-4x.png", false},
+		{"[!a]*", "b", true},
+		{"[!a]*", "abc", false},
+		{"[^a]*", "abc", false},
+		{"a/[a/]b", "a/ab", true},
+		{"a/[a/]b", "a//b", false},
+		{"a/[!x]b", "a//b", false},
+		{"a/[.-0]b", "a/.b", true},
+		{"a/[.-0]b", "a/0b", true},
+		{"a/[.-0]b", "a//b", false},
+		{"[]]", "]", true},
+		{"[a-]", "-", true},
+		{"*.{go,mod}", "go.mod", true},
+		{"*.{go,mod}", "go.sum", false},
+		{"{a,b/{c,d}}.txt", "b/d.txt", true},
+		{"{a,b/{c,d}}.txt", "b/a.txt", false},
+		{`\*.txt`, "*.txt", true},
+		{`\*.txt`, "a.txt", false},
+		{"a,b}", "a,b}", true},
+		{"файл-?.txt", "файл-ы.txt", true},
+		// classes of non-ASCII runes
+		{"[ä-ö]", "å", true},
+		{"[ä-ö]", "ö", true},
+		{"[ä-ö]", "a", false},
+		{"[!é]", "é", false},
+		{"[!é]", "e", true},
+		{"[!é]x", "éx", false},
+		{`[\ж]`, "ж", true},
+		{"[а-я]-[!ё]", "б-е", true},
+		// '**' in braces is globstar, only if braces start path segment
+		{"x{**/y}", "xa/y", true},
+		{"x{**/y}", "x/a/b/y", false},
+		{"x{a,**/y}", "x/a/y", false},
+		{"{**/a,b}", "d/e/a", true},
+		{"s/{**/a,b}", "s/d/e/a", true},
+		{"s/{c,**/a}", "s/a", true},
+	}
+	for _, tt := range tests {
+		p, err := CompilePattern(tt.pattern, false)
+		if err != nil {
+			t.Errorf("CompilePattern(%q): %v", tt.pattern, err)
+			continue
+		}
+		if got := p.Match(tt.name); got != tt.match {
+			t.Errorf("pattern %q, name %q: got %v, want %v", tt.pattern, tt.name, got, tt.match)
+		}
+	}
+}
+
+func TestPatternIgnoreCase(t *testing.T) {
+	p, err := CompilePattern("*.JPG", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !p.Match("photo.jpg") {
+		t.Error("case-insensitive pattern doesn't match")
+	}
+}
+
+func TestPatternErrors(t *testing.T) {
+	for _, pattern := range []string{"[abc", "{a,b", `a\`, "[z-a]", "[/]", "[ö-ä]", "[é"} {
+		if _, err := CompilePattern(pattern, false); err == nil {
+			t.Errorf("CompilePattern(%q): expected error", pattern)
+		}
+	}
+}
+
+func TestMatcher(t *testing.T) {
+	tests := []struct {
+		patterns []string
+		name     string
+		match    bool
+	}{
+		{nil, "a.go", false},
+		{[]string{"*.go"}, "a.go", true},
+		{[]string{"*.go", "!main.go"}, "main.go", false},
+		{[]string{"*.go", "!main.go"}, "a.go", true},
+		{[]string{"*.go", "!main.go", "cmd/main.go"}, "cmd/main.go", true},
+		{[]string{"!*.tmp"}, "a.go", true},
+		{[]string{"!*.tmp"}, "a.tmp", false},
+		{[]string{"!*.tmp", "keep.tmp"}, "keep.tmp", true},
+	}
+	for _, tt := range tests {
+		m, err := CompilePatterns(tt.patterns, false)
+		if err != nil {
+			t.Errorf("CompilePatterns(%q): %v", tt.patterns, err)
+			continue
+		}
+		if got := m.Match(tt.name); got != tt.match {
+			t.Errorf("patterns %q, name %q: got %v, want %v", tt.patterns, tt.name, got, tt.match)
+		}
+	}
+}
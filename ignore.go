@@ -0,0 +1,221 @@
+package rawpack
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// RpkIgnore is name of files with gitignore-style patterns of files to skip, which are read in each directory
+const RpkIgnore = ".rpkignore"
+
+// vcsNames are names of version control system directories skipped with Options.ExcludeVCS
+var vcsNames = []string{".git", ".svn", ".hg"}
+
+type ignoreRule struct {
+	re      *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// ignoreList is list of gitignore-style rules from one file, applied to files in directory base
+type ignoreList struct {
+	base  string
+	rules []ignoreRule
+}
+
+// parseIgnoreRule compiles line of ignore file, returns nil for blank lines and comments
+func parseIgnoreRule(line string, ignoreCase bool) (*ignoreRule, error) {
+	line = strings.TrimSuffix(line, "\r")
+	if len(line) == 0 || line[0] == '#' {
+		return nil, nil
+	}
+	// trailing spaces are ignored, unless they are escaped
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, "\\ ") {
+		line = line[:len(line)-1]
+	}
+	if len(line) == 0 {
+		return nil, nil
+	}
+	r := &ignoreRule{}
+	if line[0] == '!' {
+		r.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, "\\!") || strings.HasPrefix(line, "\\#") {
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		r.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if len(line) == 0 {
+		return nil, nil
+	}
+	// pattern with '/' at the start or in the middle is relative to directory of ignore file
+	anchored := strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+	expr, err := globToRegexp(literalBraces(line))
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern %q: %w", line, err)
+	}
+	if !anchored {
+		expr = "(?:.*/)?" + expr
+	}
+	expr = "^" + expr + "$"
+	if ignoreCase {
+		expr = "(?i)" + expr
+	}
+	if r.re, err = regexp.Compile(expr); err != nil {
+		return nil, fmt.Errorf("invalid pattern %q: %w", line, err)
+	}
+	return r, nil
+}
+
+// literalBraces escapes '{', '}' and ',' in pattern, gitignore has no alternatives
+func literalBraces(pattern string) string {
+	var sb strings.Builder
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch c {
+		case '\\':
+			sb.WriteByte(c)
+			if i+1 < len(pattern) {
+				i++
+				sb.WriteByte(pattern[i])
+			}
+			continue
+		case '{', '}', ',':
+			sb.WriteByte('\\')
+		}
+		sb.WriteByte(c)
+	}
+	return sb.String()
+}
+
+func readIgnoreList(r io.Reader, base string, ignoreCase bool) (*ignoreList, error) {
+	l := &ignoreList{base: base}
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		rule, err := parseIgnoreRule(s.Text(), ignoreCase)
+		if err != nil {
+			return nil, err
+		}
+		if rule != nil {
+			l.rules = append(l.rules, *rule)
+		}
+	}
+	return l, s.Err()
+}
+
+func readIgnoreFile(name, base string, ignoreCase bool) (*ignoreList, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	l, err := readIgnoreList(f, base, ignoreCase)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return l, nil
+}
+
+// match returns whether name (relative to root) is ignored or included by the last matching rule of list
+func (l *ignoreList) match(name string, dir bool) (ignored, matched bool) {
+	rel := name
+	if len(l.base) > 0 {
+		rel = strings.TrimPrefix(name, l.base+"/")
+	}
+	for i := len(l.rules) - 1; i >= 0; i-- {
+		it := &l.rules[i]
+		if (!it.dirOnly || dir) && it.re.MatchString(rel) {
+			return !it.negate, true
+		}
+	}
+	return false, false
+}
+
+// ignorer tracks ignore files of directories on the current path of walk
+type ignorer struct {
+	names      []string
+	ignoreCase bool
+	vcs        bool
+	global     []*ignoreList
+	stack      []*ignoreList
+}
+
+func newIgnorer(opts *Options) (*ignorer, error) {
+	ig := &ignorer{
+		// the last read file has priority
+		names:      append(append([]string{}, opts.IgnoreFiles...), RpkIgnore),
+		ignoreCase: opts.IgnoreCase,
+		vcs:        opts.ExcludeVCS,
+	}
+	for _, it := range opts.ExcludeFrom {
+		l, err := readIgnoreFile(it, "", opts.IgnoreCase)
+		if err != nil {
+			return nil, err
+		}
+		ig.global = append(ig.global, l)
+	}
+	return ig, nil
+}
+
+// ignored reports whether name (relative to root, '.' is root itself) is ignored,
+// the most nested ignore file decides
+func (ig *ignorer) ignored(name string, dir bool) bool {
+	if name == "." {
+		return false
+	}
+	// drop lists of directories, which are already walked
+	for len(ig.stack) > 0 {
+		base := ig.stack[len(ig.stack)-1].base
+		if len(base) == 0 || strings.HasPrefix(name, base+"/") {
+			break
+		}
+		ig.stack = ig.stack[:len(ig.stack)-1]
+	}
+	if ig.vcs {
+		for _, it := range vcsNames {
+			if path.Base(name) == it {
+				return true
+			}
+		}
+	}
+	for i := len(ig.stack) - 1; i >= 0; i-- {
+		if ignored, ok := ig.stack[i].match(name, dir); ok {
+			return ignored
+		}
+	}
+	for i := len(ig.global) - 1; i >= 0; i-- {
+		if ignored, ok := ig.global[i].match(name, dir); ok {
+			return ignored
+		}
+	}
+	return false
+}
+
+// enter reads ignore files of directory p with name relative to root
+func (ig *ignorer) enter(p, name string) error {
+	if name == "." {
+		name = ""
+	}
+	for _, it := range ig.names {
+		l, err := readIgnoreFile(filepath.Join(p, it), name, ig.ignoreCase)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		ig.stack = append(ig.stack, l)
+	}
+	return nil
+}
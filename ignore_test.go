@@ -0,0 +1,117 @@
+package rawpack
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseIgnoreRule(t *testing.T) {
+	tests := []struct {
+		line    string
+		name    string
+		dir     bool
+		ignored bool
+		matched bool
+	}{
+		{"*.log", "a.log", false, true, true},
+		{"*.log", "sub/a.log", false, true, true},
+		{"/a.log", "sub/a.log", false, false, false},
+		{"/a.log", "a.log", false, true, true},
+		{"sub/*.log", "sub/a.log", false, true, true},
+		{"sub/*.log", "x/sub/a.log", false, false, false},
+		{"build/", "build", true, true, true},
+		{"build/", "build", false, false, false},
+		{"!keep.log", "keep.log", false, false, true},
+		{`\!keep.log`, "!keep.log", false, true, true},
+		{`\#note`, "#note", false, true, true},
+		{"a.log   ", "a.log", false, true, true},
+		{`a.log\ `, "a.log ", false, true, true},
+		{"**/cache/**", "x/cache/y", false, true, true},
+		// braces are literal in gitignore
+		{"{a,b}.txt", "{a,b}.txt", false, true, true},
+		{"{a,b}.txt", "a.txt", false, false, false},
+		{`\{a\}`, "{a}", false, true, true},
+	}
+	for _, tt := range tests {
+		r, err := parseIgnoreRule(tt.line, false)
+		if err != nil || r == nil {
+			t.Errorf("parseIgnoreRule(%q): %v, %v", tt.line, r, err)
+			continue
+		}
+		l := &ignoreList{rules: []ignoreRule{*r}}
+		ignored, matched := l.match(tt.name, tt.dir)
+		if ignored != tt.ignored || matched != tt.matched {
+			t.Errorf("rule %q, name %q: got %v, %v, want %v, %v", tt.line, tt.name, ignored, matched, tt.ignored, tt.matched)
+		}
+	}
+}
+
+func TestParseIgnoreRuleSkipped(t *testing.T) {
+	for _, line := range []string{"", "# comment", "   ", "\r", "/"} {
+		r, err := parseIgnoreRule(line, false)
+		if err != nil || r != nil {
+			t.Errorf("parseIgnoreRule(%q): %v, %v, expected nothing", line, r, err)
+		}
+	}
+}
+
+func TestIgnoreListLastRuleWins(t *testing.T) {
+	l, err := readIgnoreList(strings.NewReader("*.log\n!keep.log\nkeep.log\n!keep.log\n"), "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ignored, _ := l.match("keep.log", false); ignored {
+		t.Error("keep.log is ignored")
+	}
+	if ignored, _ := l.match("a.log", false); !ignored {
+		t.Error("a.log is not ignored")
+	}
+}
+
+func TestIgnorerNested(t *testing.T) {
+	root := t.TempDir()
+	write := func(name, content string) {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(".gitignore", "*.log\n")
+	write(RpkIgnore, "*.tmp\n")
+	write("sub/"+RpkIgnore, "!keep.log\n/local.txt\n")
+	write("sub/deep/x", "")
+
+	ig, err := newIgnorer(&Options{IgnoreFiles: []string{".gitignore"}, ExcludeVCS: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ig.enter(root, "."); err != nil {
+		t.Fatal(err)
+	}
+	check := func(name string, dir, want bool) {
+		t.Helper()
+		if got := ig.ignored(name, dir); got != want {
+			t.Errorf("ignored(%q) = %v, want %v", name, got, want)
+		}
+	}
+	check("a.log", false, true)
+	check("a.tmp", false, true)
+	check("a.txt", false, false)
+	check(".git", true, true)
+	check("sub", true, false)
+	if err := ig.enter(filepath.Join(root, "sub"), "sub"); err != nil {
+		t.Fatal(err)
+	}
+	check("sub/a.log", false, true)
+	check("sub/keep.log", false, false)
+	check("sub/local.txt", false, true)
+	check("sub/deep/local.txt", false, false)
+	// leaving directory drops its rules
+	check("other/keep.log", false, true)
+	check("other/local.txt", false, false)
+}
@@ -9,17 +9,100 @@ import (
 
 type File struct {
 	Name string
+	// Size is count of bytes stored in archive, see ContentSize
 	Size uint64
+	// Path is the location of the file on disk, when it differs from Name.
+	// It is not stored in archive.
+	Path string
+	// Extensions are additional attributes of file, archive with them has FlagExtensions
+	Extensions []Extension
+
+	// dict is ZSTD dictionary of archive, which file was read from, it is used for file compressed separately
+	dict []byte
+}
+
+// Extension is named attribute of file
+type Extension struct {
+	Key   string
+	Value []byte
+}
+
+// Extension returns value of extension with key
+func (f *File) Extension(key string) ([]byte, bool) {
+	for _, it := range f.Extensions {
+		if it.Key == key {
+			return it.Value, true
+		}
+	}
+	return nil, false
+}
+
+// SetExtension sets value of extension with key
+func (f *File) SetExtension(key string, value []byte) {
+	for i, it := range f.Extensions {
+		if it.Key == key {
+			f.Extensions[i].Value = value
+			return
+		}
+	}
+	f.Extensions = append(f.Extensions, Extension{Key: key, Value: value})
+}
+
+// flags returns flags of format required to store file table
+func (ft FileTable) flags() (f FormatFlag) {
+	for _, it := range ft {
+		if len(it.Extensions) > 0 {
+			f |= FlagExtensions
+		}
+	}
+	return
 }
 
 type FileTable []File
 
+// archiveSize returns size of archive with files of ft
+func (ft FileTable) archiveSize() uint64 {
+	extensions := ft.flags()&FlagExtensions != 0
+	size := uint64(len(Signature{})) + 8
+	for _, it := range ft {
+		size += 8 + uint64(len(it.Name)) + 8 + it.Size
+		if extensions {
+			size += 8
+			for _, e := range it.Extensions {
+				size += 8 + uint64(len(e.Key)) + 8 + uint64(len(e.Value))
+			}
+		}
+	}
+	return size
+}
+
+// Read opens file on disk, for sparse file only its data is read.
+// File compressed separately is read from spooled file as is.
 func (f File) Read() (io.ReadCloser, error) {
-	return os.Open(f.Name)
+	name := f.Name
+	if len(f.Path) > 0 {
+		name = f.Path
+	}
+	if _, ok := f.Extension(ExtCodec); ok {
+		return os.Open(name)
+	}
+	m, err := f.SparseMap()
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(name)
+	if err != nil || m == nil {
+		return file, err
+	}
+	return newSparseDataReader(file, m), nil
 }
 
 func (f File) Write() (io.WriteCloser, error) {
-	dir := filepath.Dir(f.Name)
+	name := f.Name
+	if len(f.Path) > 0 {
+		name = f.Path
+	}
+	dir := filepath.Dir(name)
 	if info, err := os.Stat(dir); err != nil {
 		if err := os.MkdirAll(dir, 0755); err != nil {
 			return nil, err
@@ -27,5 +110,11 @@ func (f File) Write() (io.WriteCloser, error) {
 	} else if !info.IsDir() {
 		return nil, fmt.Errorf("expected dir at %q", dir)
 	}
-	return os.OpenFile(f.Name, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	return os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+}
+
+func closeOnReturn(c io.Closer, err *error) {
+	if e := c.Close(); e != nil && *err == nil {
+		*err = e
+	}
 }
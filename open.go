@@ -0,0 +1,69 @@
+package rawpack
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+var ErrNotSeekable = errors.New("compressed data cannot be read at random positions")
+
+// OpenReader prepares archive for sequential reading (decompression and decryption) and reads its file table.
+// Returned reader must be closed to release decompressor.
+func OpenReader(r io.Reader, opts Options) (*Reader, FileTable, error) {
+	r, c, dict, err := opts.wrapReader(r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if opts.Key != nil {
+		r = newCryptoReader(r, opts.Key)
+	}
+
+	archive := NewReader(r)
+	archive.closer = c
+	archive.dict = dict
+	ft, err := func() (FileTable, error) {
+		s, err := archive.ReadSignature()
+		if err != nil {
+			return nil, err
+		}
+		if !s.IsValid() {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidSignature, string(s[:]))
+		}
+		return archive.ReadFileTable()
+	}()
+	if err != nil {
+		_ = archive.Close()
+		return nil, nil, err
+	}
+	return archive, ft, nil
+}
+
+// OpenReaderAt prepares archive for random access (decryption),
+// returns ErrNotSeekable if archive is compressed
+func OpenReaderAt(r io.ReaderAt, size int64, opts Options) (*ReaderAt, error) {
+	if opts.codec() != CodecNone {
+		return nil, ErrNotSeekable
+	}
+	dict, err := readDictPrefix(r)
+	if err != nil {
+		return nil, err
+	}
+	// files compressed separately are read with dictionary, which is before signature
+	start := dictFrameSize(dict)
+	magic := make([]byte, len(s2Magic))
+	n, _ := r.ReadAt(magic, start)
+	if detectCodec(magic[:n]) != CodecNone {
+		return nil, ErrNotSeekable
+	}
+	if start > 0 {
+		r = io.NewSectionReader(r, start, size-start)
+		size -= start
+	}
+
+	if opts.Key != nil {
+		r = newCryptoReaderAt(r, opts.Key)
+	}
+	return newReaderAt(r, size, dict)
+}
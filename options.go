@@ -0,0 +1,105 @@
+package rawpack
+
+import (
+	"io"
+)
+
+const (
+	defaultJobs       = 4
+	defaultReadAhead  = 64 << 20 // 64MB
+	defaultBufferSize = 1 << 20  // 1MB
+)
+
+// Source is a file with contents from Reader, which is packed after files found in directory
+type Source struct {
+	Name   string
+	Reader io.Reader
+}
+
+type Options struct {
+	// Include contains glob patterns of files to pack (see Pattern), all files are packed if it is empty
+	Include []string
+	// Exclude contains glob patterns of files to skip
+	Exclude []string
+	// ExcludeFrom contains names of files with gitignore-style patterns of files to skip.
+	// Files named RpkIgnore in walked directories are always honored.
+	ExcludeFrom []string
+	// IgnoreFiles contains names of additional files with gitignore-style patterns, like ".gitignore",
+	// which are read in each walked directory
+	IgnoreFiles []string
+	// ExcludeVCS skips directories of version control systems (.git, .svn, .hg)
+	ExcludeVCS bool
+	// IgnoreCase enables case-insensitive matching of patterns
+	IgnoreCase bool
+	// Files contains names of files to pack in order of list, relative to root of PackDir.
+	// Directories are packed with all files in them.
+	Files   []string
+	Sources []Source
+
+	// Key enables encryption of archive, see DeriveKey
+	Key *Key
+	// Zstd enables ZSTD compression of created archive.
+	// When reading, nil means detection of compressed archive with auto parameters.
+	Zstd *ZstdOptions
+	// Codec is compression of created archive, if Zstd is nil.
+	// When reading, CodecNone means detection of compression by magic bytes.
+	Codec Codec
+	// EntryCodec enables compression of each file separately instead of whole archive,
+	// files, which don't shrink, are stored uncompressed (see Incompressible).
+	// Compressed files are spooled before packing. Zstd may contain parameters and rules of levels of files.
+	EntryCodec     Codec
+	Incompressible IncompressibleOptions
+	// ZstdDict is ZSTD dictionary, which is stored in archive and used for compression by ZSTD
+	// of archive or of files compressed separately
+	ZstdDict []byte
+	// TrainZstdDict enables training of ZSTD dictionary of size ZstdDictSize (DefaultDictSize if it is 0)
+	// from files being packed
+	TrainZstdDict bool
+	ZstdDictSize  int
+	Progress      Progress
+
+	// Sparse enables detection of holes in files, only data of sparse files is stored,
+	// and holes are recreated on extraction
+	Sparse bool
+	// Xattrs enables storing and restoring of extended attributes of files, including POSIX ACLs
+	// (system.posix_acl_*), which match XattrInclude (all if it is empty) and don't match XattrExclude.
+	// Patterns are globs of names of attributes, or namespaces like "user" or "security".
+	// Attributes of directories (including default ACLs) are not stored, so packing fails,
+	// if walked directory has selected attributes.
+	Xattrs       bool
+	XattrInclude []string
+	XattrExclude []string
+	// Reproducible makes archive byte-identical for identical inputs: found files are sorted by name
+	// (files of Files and Sources keep their order), and ZSTD parameters don't depend on machine.
+	// Archive doesn't store modification times and owners of files, so they don't affect output.
+	Reproducible bool
+
+	// Jobs is count of goroutines reading files while packing, or writing files while extracting
+	Jobs int
+	// ReadAhead limits memory for files read ahead while packing
+	ReadAhead  uint64
+	BufferSize int
+	// WriteSpeed is measured speed of output storage (buffers per second), used for auto ZSTD parameters
+	WriteSpeed float64
+}
+
+func (o *Options) jobs() int {
+	if o.Jobs <= 0 {
+		return defaultJobs
+	}
+	return o.Jobs
+}
+
+func (o *Options) readAhead() uint64 {
+	if o.ReadAhead == 0 {
+		return defaultReadAhead
+	}
+	return o.ReadAhead
+}
+
+func (o *Options) buffer() []byte {
+	if o.BufferSize <= 0 {
+		return make([]byte, defaultBufferSize)
+	}
+	return make([]byte, o.BufferSize)
+}
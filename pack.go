@@ -0,0 +1,179 @@
+package rawpack
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"slices"
+	"strings"
+)
+
+// PackDir writes archive to w with files found in root, which match opts.Include and don't match opts.Exclude,
+// followed by opts.Files and opts.Sources. If root is empty, or opts.Files is set without opts.Include,
+// root is not walked.
+func PackDir(ctx context.Context, w io.Writer, root string, opts Options) (err error) {
+	var sp spooler
+	defer func() {
+		if e := sp.Close(); e != nil && err == nil {
+			err = e
+		}
+	}()
+
+	ft, err := findFileTable(ctx, root, &opts, &sp)
+	if err != nil {
+		return err
+	}
+	for _, it := range opts.Sources {
+		ft = append(ft, File{Name: it.Name})
+		if err := sp.spool(ctx, &ft[len(ft)-1], it.Reader); err != nil {
+			return err
+		}
+	}
+	return Pack(ctx, w, ft, opts)
+}
+
+// findFileTable finds files in root and files of opts.Files, see PackDir
+func findFileTable(ctx context.Context, root string, opts *Options, sp *spooler) (FileTable, error) {
+	fd, err := newFinder(ctx, root, opts, sp)
+	if err != nil {
+		return nil, err
+	}
+	if len(root) > 0 && (len(opts.Files) == 0 || len(opts.Include) > 0) {
+		include, err := CompilePatterns(opts.Include, opts.IgnoreCase)
+		if err != nil {
+			return nil, err
+		}
+		if err := fd.walk(root, "", include); err != nil {
+			return nil, err
+		}
+		if opts.Reproducible {
+			// order of walk depends on file system, so it is fixed explicitly
+			slices.SortFunc(fd.files, func(a, b File) int {
+				return strings.Compare(a.Name, b.Name)
+			})
+		}
+	}
+	if err := fd.addListed(opts.Files); err != nil {
+		return nil, err
+	}
+	return fd.files, nil
+}
+
+func packFile(ctx context.Context, out io.Writer, f *File, pf prefetched, buf []byte, p Progress) error {
+	if pf.err != nil {
+		return pf.err
+	}
+	var src io.Reader = bytes.NewReader(pf.data)
+	if pf.rest != nil {
+		defer pf.rest.Close()
+		src = io.MultiReader(src, pf.rest)
+	}
+	return copyFile(ctx, out, src, f, buf, p)
+}
+
+// Pack writes archive to w with files of ft.
+// After cancellation of ctx, *CancelError is returned and w contains incomplete archive.
+func Pack(ctx context.Context, w io.Writer, ft FileTable, opts Options) error {
+	return pack(ctx, w, ft, opts, &segment{})
+}
+
+// segment describes position of packed files in archive, they are appended to archive by Appender
+type segment struct {
+	// offset is size of uncompressed archive before files, it is increased by size of packed segment
+	offset uint64
+	// dict is ZSTD dictionary of archive, which is stored at its start
+	dict []byte
+}
+
+func pack(ctx context.Context, w io.Writer, ft FileTable, opts Options, seg *segment) (err error) {
+	if opts.EntryCodec != CodecNone && (opts.Codec != CodecNone || (opts.Zstd != nil && opts.EntryCodec != CodecZstd)) {
+		return errors.New("compression of files cannot be combined with compression of archive")
+	}
+
+	d := opts.ZstdDict
+	if (d != nil || opts.TrainZstdDict) && opts.codec() != CodecZstd && opts.EntryCodec != CodecZstd {
+		return errors.New("ZSTD dictionary requires ZSTD compression")
+	}
+	if seg.dict != nil {
+		if d != nil || opts.TrainZstdDict {
+			return errors.New("appended files are compressed with ZSTD dictionary of archive")
+		}
+		d = seg.dict
+	}
+	if opts.TrainZstdDict {
+		if opts.Reproducible {
+			// training gives different dictionaries for the same samples
+			return errors.New("trained ZSTD dictionary is not reproducible, use dictionary trained before")
+		}
+		if d, err = trainZstdDict(ctx, ft, opts.ZstdDictSize); err != nil {
+			return err
+		}
+	}
+	if d != nil {
+		if err := ValidateZstdDict(d); err != nil {
+			return err
+		}
+	}
+
+	if opts.EntryCodec != CodecNone {
+		var sp spooler
+		defer func() {
+			if e := sp.Close(); e != nil && err == nil {
+				err = e
+			}
+		}()
+		// table is copied, so compressed sizes of files are not returned to caller
+		ft = slices.Clone(ft)
+		if err := compressEntries(ctx, ft, &opts, d, &sp); err != nil {
+			return err
+		}
+	}
+
+	fileSize := ft.archiveSize()
+	if d != nil && seg.dict == nil {
+		if err := writeDictFrame(w, d); err != nil {
+			return err
+		}
+	}
+	w, c, err := opts.wrapWriter(w, fileSize, d)
+	if err != nil {
+		return err
+	}
+	if c != nil {
+		defer closeOnReturn(c, &err)
+	}
+
+	if opts.Key != nil {
+		w = newCryptoWriterAt(w, opts.Key, seg.offset)
+	}
+	seg.offset += fileSize
+
+	archive := NewWriter(w)
+	err = archive.WriteSignature(NewSignature().WithFlags(ft.flags()))
+	if err == nil {
+		err = archive.WriteFileTable(ft)
+	}
+	if err != nil {
+		return err
+	}
+
+	if opts.Progress != nil {
+		opts.Progress.Start(ft)
+	}
+
+	pf := newPrefetcher(ctx, ft, opts.jobs(), opts.readAhead())
+	defer pf.close()
+
+	buf := opts.buffer()
+	for i := range ft {
+		if err := checkContext(ctx, ""); err != nil {
+			return err
+		}
+		if err := packFile(ctx, archive, &ft[i], pf.next(i), buf, opts.Progress); err != nil {
+			return err
+		}
+		pf.done(i)
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+package rawpack
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"maps"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeTree creates files with contents in dir, names are slash-separated
+func writeTree(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// checkTree checks, that dir contains files with contents
+func checkTree(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	count := 0
+	err := filepath.WalkDir(dir, func(p string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		count++
+		rel, _ := filepath.Rel(dir, p)
+		want, ok := files[filepath.ToSlash(rel)]
+		if !ok {
+			t.Errorf("unexpected file %q", rel)
+			return nil
+		}
+		got, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		if string(got) != want {
+			t.Errorf("%s: got %q, want %q", rel, got, want)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != len(files) {
+		t.Errorf("got %d files, want %d", count, len(files))
+	}
+}
+
+var testFiles = map[string]string{
+	"a.txt":         "alpha",
+	"b.log":         string(bytes.Repeat([]byte("log line\n"), 1000)),
+	"empty":         "",
+	"sub/c.txt":     "gamma",
+	"sub/deep/d.go": "package d",
+}
+
+// forEachCodec runs f in subtests with options of uncompressed, compressed and encrypted archives,
+// and of archive with files compressed separately
+func forEachCodec(t *testing.T, f func(t *testing.T, opts Options)) {
+	t.Helper()
+	zstd, err := ParseZstdOptions("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		opts Options
+	}{
+		{"none", Options{}},
+		{"zstd", Options{Zstd: zstd}},
+		{"gzip", Options{Codec: CodecGzip}},
+		{"entry zstd", Options{EntryCodec: CodecZstd}},
+		{"encrypted", Options{Key: NewKey([]byte("secret"))}},
+		{"zstd crypto", Options{Zstd: zstd, Key: NewKey([]byte("secret"))}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f(t, tt.opts)
+		})
+	}
+}
+
+func TestPackDirReproducible(t *testing.T) {
+	files := maps.Clone(testFiles)
+	// large file is compressed by several blocks on several threads
+	rnd := rand.New(rand.NewSource(1))
+	var sb strings.Builder
+	for sb.Len() < 4<<20 {
+		fmt.Fprintf(&sb, "%d %x\n", rnd.Intn(1000), rnd.Int63())
+	}
+	files["large.txt"] = sb.String()
+	root := t.TempDir()
+	writeTree(t, root, files)
+
+	pack := func(opts Options, zstd string) []byte {
+		t.Helper()
+		if len(zstd) > 0 {
+			z, err := ParseZstdOptions(zstd)
+			if err != nil {
+				t.Fatal(err)
+			}
+			opts.Zstd = z
+		}
+		opts.Reproducible = true
+		var buf bytes.Buffer
+		if err := PackDir(context.Background(), &buf, root, opts); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+	tests := []struct {
+		name string
+		opts Options
+		// archives packed with these ZSTD options are identical
+		zstd []string
+	}{
+		{"none", Options{}, []string{"", ""}},
+		{"gzip", Options{Codec: CodecGzip}, []string{"", ""}},
+		{"zstd", Options{}, []string{"auto", "auto", "t=1", "t=2", "t=8"}},
+		{"zstd high", Options{}, []string{"l=high,t=1", "l=high,t=8"}},
+		{"entry zstd", Options{EntryCodec: CodecZstd}, []string{"auto", "t=1", "t=8"}},
+	}
+	for _, tt := range tests {
+		first := pack(tt.opts, tt.zstd[0])
+		for _, it := range tt.zstd[1:] {
+			if !bytes.Equal(pack(tt.opts, it), first) {
+				t.Errorf("%s: archives packed with %q and %q differ", tt.name, tt.zstd[0], it)
+			}
+		}
+		dest := t.TempDir()
+		if err := Extract(context.Background(), bytes.NewReader(first), dest, Options{}); err != nil {
+			t.Fatal(err)
+		}
+		checkTree(t, dest, files)
+	}
+}
@@ -0,0 +1,119 @@
+package rawpack
+
+import (
+	"bytes"
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+var ErrEmptyPassword = errors.New("password is empty")
+
+// Key is encryption key of archive, derived from password
+type Key struct {
+	hash [md5.Size]byte
+}
+
+// NewKey derives key from password and wipes password bytes
+func NewKey(password []byte) *Key {
+	k := &Key{hash: md5.Sum(password)}
+	clear(password)
+	return k
+}
+
+// PasswordSource returns password, which bytes are wiped after key derivation
+type PasswordSource func() ([]byte, error)
+
+// DeriveKey reads password from src and derives key from it
+func DeriveKey(src PasswordSource) (*Key, error) {
+	password, err := src()
+	if err != nil {
+		clear(password)
+		return nil, err
+	}
+	if len(password) == 0 {
+		return nil, ErrEmptyPassword
+	}
+	return NewKey(password), nil
+}
+
+// PasswordBytes returns copy of password, so the original is not wiped
+func PasswordBytes(password []byte) PasswordSource {
+	return func() ([]byte, error) {
+		return bytes.Clone(password), nil
+	}
+}
+
+// maxPasswordSize limits length of password read by PasswordReader
+const maxPasswordSize = 4096
+
+// PasswordReader reads password from the first line of r, which must not be longer than 4096 bytes
+func PasswordReader(r io.Reader) PasswordSource {
+	return func() ([]byte, error) {
+		// password is read to fixed buffer, growing buffer would leave its copies in memory
+		var buf [maxPasswordSize + 1]byte
+		defer clear(buf[:])
+		n, end := 0, -1
+		for n < len(buf) && end < 0 {
+			m, err := r.Read(buf[n:])
+			if i := bytes.IndexByte(buf[n:n+m], '\n'); i >= 0 {
+				end = n + i
+			}
+			n += m
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				return nil, err
+			}
+		}
+		if end < 0 {
+			if n == len(buf) {
+				return nil, fmt.Errorf("password is longer than %d bytes", maxPasswordSize)
+			}
+			end = n
+		}
+		return bytes.Clone(bytes.TrimSuffix(buf[:end], []byte{'\r'})), nil
+	}
+}
+
+// PasswordFile reads password from the first line of file
+func PasswordFile(name string) PasswordSource {
+	return func() ([]byte, error) {
+		f, err := os.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return PasswordReader(f)()
+	}
+}
+
+// PasswordEnv reads password from environment variable.
+// Value of variable cannot be wiped, only its copy is.
+func PasswordEnv(name string) PasswordSource {
+	return func() ([]byte, error) {
+		v, ok := os.LookupEnv(name)
+		if !ok {
+			return nil, fmt.Errorf("environment variable %q is not set", name)
+		}
+		return []byte(v), nil
+	}
+}
+
+// PasswordFD reads password from the first line of opened file descriptor, and closes it
+func PasswordFD(fd uintptr) PasswordSource {
+	return func() ([]byte, error) {
+		f := os.NewFile(fd, fmt.Sprintf("fd %d", fd))
+		if f == nil {
+			return nil, fmt.Errorf("invalid file descriptor %d", fd)
+		}
+		defer f.Close()
+		password, err := PasswordReader(f)()
+		if err != nil {
+			return nil, fmt.Errorf("reading password from fd %d: %w", fd, err)
+		}
+		return password, nil
+	}
+}
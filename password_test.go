@@ -0,0 +1,84 @@
+package rawpack
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPasswordReader(t *testing.T) {
+	long := strings.Repeat("p", maxPasswordSize)
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"secret", "secret"},
+		{"secret\n", "secret"},
+		{"secret\r\nnext line\n", "secret"},
+		{"\nsecret", ""},
+		{"", ""},
+		{"pass word \t\n", "pass word \t"},
+		{long, long},
+		{long + "\n" + long, long},
+	}
+	for _, tt := range tests {
+		for _, r := range []func(s string) PasswordSource{
+			func(s string) PasswordSource { return PasswordReader(strings.NewReader(s)) },
+			func(s string) PasswordSource { return PasswordReader(&oneByteReader{strings.NewReader(s)}) },
+		} {
+			got, err := r(tt.in)()
+			if err != nil {
+				t.Errorf("PasswordReader(%.20q): %v", tt.in, err)
+			} else if string(got) != tt.want {
+				t.Errorf("PasswordReader(%.20q) = %.20q, want %.20q", tt.in, got, tt.want)
+			}
+		}
+	}
+	if _, err := PasswordReader(strings.NewReader(long + "x\n"))(); err == nil {
+		t.Error("expected error for too long password")
+	}
+}
+
+func TestDeriveKey(t *testing.T) {
+	password := []byte("secret")
+	k1, err := DeriveKey(PasswordBytes(password))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(password) != "secret" {
+		t.Error("PasswordBytes wiped original password")
+	}
+	if k2 := NewKey([]byte("secret")); *k1 != *k2 {
+		t.Error("keys of the same password differ")
+	}
+	if _, err := DeriveKey(PasswordReader(strings.NewReader("\n"))); !errors.Is(err, ErrEmptyPassword) {
+		t.Errorf("got %v, want ErrEmptyPassword", err)
+	}
+	errSource := errors.New("source")
+	if _, err := DeriveKey(func() ([]byte, error) { return nil, errSource }); !errors.Is(err, errSource) {
+		t.Errorf("got %v, want error of source", err)
+	}
+}
+
+func TestPasswordSources(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "password")
+	if err := os.WriteFile(p, []byte("from file\nsecond line\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := PasswordFile(p)(); err != nil || string(got) != "from file" {
+		t.Errorf("PasswordFile: %q, %v", got, err)
+	}
+	if _, err := PasswordFile(p + ".missing")(); err == nil {
+		t.Error("PasswordFile: expected error for missing file")
+	}
+
+	t.Setenv("RPK_TEST_PASSWORD", "from env")
+	if got, err := PasswordEnv("RPK_TEST_PASSWORD")(); err != nil || string(got) != "from env" {
+		t.Errorf("PasswordEnv: %q, %v", got, err)
+	}
+	if _, err := PasswordEnv("RPK_TEST_PASSWORD_UNSET")(); err == nil {
+		t.Error("PasswordEnv: expected error for unset variable")
+	}
+}
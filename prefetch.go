@@ -0,0 +1,174 @@
+package rawpack
+
+import (
+	"context"
+	"io"
+	"sync"
+)
+
+type memoryBudget struct {
+	mu     sync.Mutex
+	cond   sync.Cond
+	avail  uint64
+	closed bool
+}
+
+func newMemoryBudget(limit uint64) *memoryBudget {
+	b := &memoryBudget{
+		avail: limit,
+	}
+	b.cond.L = &b.mu
+	return b
+}
+
+func (b *memoryBudget) acquire(n uint64) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for b.avail < n && !b.closed {
+		b.cond.Wait()
+	}
+	if b.closed {
+		return false
+	}
+	b.avail -= n
+	return true
+}
+
+func (b *memoryBudget) release(n uint64) {
+	b.mu.Lock()
+	b.avail += n
+	b.mu.Unlock()
+	b.cond.Broadcast()
+}
+
+func (b *memoryBudget) close() {
+	b.mu.Lock()
+	b.closed = true
+	b.mu.Unlock()
+	b.cond.Broadcast()
+}
+
+// prefetchChunk is size of reads of prefetched files
+const prefetchChunk = 1 << 20
+
+type prefetched struct {
+	data []byte
+	rest io.ReadCloser
+	err  error
+}
+
+// prefetcher opens and reads files of table on several goroutines, while
+// results are consumed strictly in table order. Memory is reserved in table
+// order too, so the file being consumed always has its reservation and
+// consumer never waits for files after it
+type prefetcher struct {
+	ctx     context.Context
+	cancel  context.CancelFunc
+	ft      FileTable
+	limit   uint64
+	budget  *memoryBudget
+	results []chan prefetched
+	wg      sync.WaitGroup
+}
+
+func newPrefetcher(ctx context.Context, ft FileTable, jobs int, limit uint64) *prefetcher {
+	// reading is cancelled by close, when consumer stops before the end of table
+	ctx, cancel := context.WithCancel(ctx)
+	p := &prefetcher{
+		ctx:     ctx,
+		cancel:  cancel,
+		ft:      ft,
+		limit:   max(1, limit),
+		results: make([]chan prefetched, len(ft)),
+	}
+	p.budget = newMemoryBudget(p.limit)
+	for i := range p.results {
+		p.results[i] = make(chan prefetched, 1)
+	}
+
+	queue := make(chan int)
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		defer close(queue)
+		for i := range p.ft {
+			if ctx.Err() != nil || !p.budget.acquire(p.reserved(i)) {
+				return
+			}
+			queue <- i
+		}
+	}()
+
+	for range max(1, jobs) {
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			for i := range queue {
+				p.results[i] <- p.fetch(&p.ft[i], p.reserved(i))
+			}
+		}()
+	}
+	return p
+}
+
+func (p *prefetcher) reserved(i int) uint64 {
+	return min(p.ft[i].Size, p.limit)
+}
+
+func (p *prefetcher) fetch(f *File, n uint64) (res prefetched) {
+	rc, err := f.Read()
+	if err != nil {
+		res.err = err
+		return
+	}
+	res.data = make([]byte, n)
+	r := &contextReader{ctx: p.ctx, name: f.Name, r: rc}
+	// data is read by chunks, so reading stops soon after cancellation
+	for off := uint64(0); off < n && err == nil; off += prefetchChunk {
+		_, err = io.ReadFull(r, res.data[off:min(off+prefetchChunk, n)])
+		if err == io.EOF && off > 0 {
+			err = io.ErrUnexpectedEOF
+		}
+	}
+	if err != nil {
+		_ = rc.Close()
+		res.data = nil
+		res.err = err
+		return
+	}
+	if n < f.Size {
+		res.rest = rc
+	} else {
+		_ = rc.Close()
+	}
+	return
+}
+
+func (p *prefetcher) next(i int) prefetched {
+	select {
+	case res := <-p.results[i]:
+		return res
+	case <-p.ctx.Done():
+		return prefetched{err: checkContext(p.ctx, p.ft[i].Name)}
+	}
+}
+
+func (p *prefetcher) done(i int) {
+	p.budget.release(p.reserved(i))
+}
+
+// close stops reading of files, which are not consumed yet, and waits for goroutines
+func (p *prefetcher) close() {
+	p.cancel()
+	p.budget.close()
+	p.wg.Wait()
+	for _, it := range p.results {
+		select {
+		case res := <-it:
+			if res.rest != nil {
+				_ = res.rest.Close()
+			}
+		default:
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package rawpack
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestPrefetcherStopsAfterClose(t *testing.T) {
+	fifo := filepath.Join(t.TempDir(), "fifo")
+	if err := syscall.Mkfifo(fifo, 0644); err != nil {
+		t.Skip("FIFO is not supported:", err)
+	}
+	const size = 64 * prefetchChunk
+	written := make(chan int)
+	go func() {
+		f, err := os.OpenFile(fifo, os.O_WRONLY, 0)
+		if err != nil {
+			written <- -1
+			return
+		}
+		defer f.Close()
+		n := 0
+		chunk := make([]byte, 64<<10)
+		for n < size {
+			m, err := f.Write(chunk)
+			n += m
+			if n == len(chunk) {
+				// prefetcher reads the file
+				written <- n
+			}
+			if err != nil {
+				break
+			}
+		}
+		written <- n
+	}()
+	p := newPrefetcher(context.Background(), FileTable{{Name: "fifo", Size: size, Path: fifo}}, 1, size)
+	if n := <-written; n < 0 {
+		t.Fatal("FIFO is not opened")
+	}
+	// consumer stops before the file is read
+	p.close()
+	if n := <-written; n >= size {
+		t.Error("file is read to the end after close")
+	}
+}
@@ -0,0 +1,122 @@
+package rawpack
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMemoryBudget(t *testing.T) {
+	b := newMemoryBudget(10)
+	if !b.acquire(6) {
+		t.Fatal("acquire failed")
+	}
+	acquired := make(chan bool)
+	go func() {
+		acquired <- b.acquire(6)
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("budget is exceeded")
+	case <-time.After(20 * time.Millisecond):
+	}
+	b.release(6)
+	if !<-acquired {
+		t.Fatal("acquire failed after release")
+	}
+	go func() {
+		acquired <- b.acquire(6)
+	}()
+	b.close()
+	if <-acquired {
+		t.Error("acquire succeeded after close")
+	}
+}
+
+// prefetchTable creates files with contents and returns their table
+func prefetchTable(t *testing.T, contents []string) FileTable {
+	t.Helper()
+	root := t.TempDir()
+	var ft FileTable
+	for i, it := range contents {
+		name := fmt.Sprintf("f%d", i)
+		writeTree(t, root, map[string]string{name: it})
+		ft = append(ft, File{Name: name, Size: uint64(len(it)), Path: filepath.Join(root, name)})
+	}
+	return ft
+}
+
+func TestPrefetcher(t *testing.T) {
+	contents := []string{"", "a", "bbbb", strings.Repeat("c", 25), "dd", strings.Repeat("e", prefetchChunk+10)}
+	for _, limit := range []uint64{1, 4, 10, 1 << 30} {
+		for _, jobs := range []int{1, 3} {
+			ft := prefetchTable(t, contents)
+			p := newPrefetcher(context.Background(), ft, jobs, limit)
+			for i := range ft {
+				res := p.next(i)
+				if res.err != nil {
+					t.Fatal(res.err)
+				}
+				if uint64(len(res.data)) > limit {
+					t.Errorf("limit %d: %d bytes are read ahead", limit, len(res.data))
+				}
+				got := string(res.data)
+				if res.rest != nil {
+					rest, err := io.ReadAll(res.rest)
+					if err != nil {
+						t.Fatal(err)
+					}
+					_ = res.rest.Close()
+					got += string(rest)
+				}
+				if got != contents[i] {
+					t.Errorf("limit %d, jobs %d: file %d differs", limit, jobs, i)
+				}
+				p.done(i)
+			}
+			p.close()
+		}
+	}
+}
+
+func TestPrefetcherBudget(t *testing.T) {
+	ft := prefetchTable(t, []string{"aaaa", "bbbb", "cccc", "dddd", "eeee", "ffff"})
+	p := newPrefetcher(context.Background(), ft, 4, 10)
+	defer p.close()
+	// files are not consumed, so only two files fit in the limit
+	time.Sleep(50 * time.Millisecond)
+	ready := 0
+	for _, it := range p.results {
+		ready += len(it)
+	}
+	if ready > 2 {
+		t.Errorf("%d files are read ahead, limit allows 2", ready)
+	}
+	for i := range ft {
+		if res := p.next(i); res.err != nil || string(res.data) != strings.Repeat(string(rune('a'+i)), 4) {
+			t.Fatalf("file %d: %q, %v", i, res.data, res.err)
+		}
+		p.done(i)
+	}
+}
+
+func TestPrefetcherMissingFile(t *testing.T) {
+	ft := prefetchTable(t, []string{"a", "b"})
+	if err := os.Remove(ft[1].Path); err != nil {
+		t.Fatal(err)
+	}
+	p := newPrefetcher(context.Background(), ft, 2, 1<<20)
+	defer p.close()
+	if res := p.next(0); res.err != nil {
+		t.Fatal(res.err)
+	}
+	p.done(0)
+	if res := p.next(1); !os.IsNotExist(res.err) {
+		t.Errorf("got %v, want not exist error", res.err)
+	}
+}
@@ -0,0 +1,73 @@
+package rawpack
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// Progress receives notifications about copying of files.
+// Methods may be called concurrently, when files are copied in parallel.
+type Progress interface {
+	// Start is called with all files to be processed, before the first of them.
+	// When archive is read sequentially, it is called for each segment of archive (see Appender).
+	Start(ft FileTable)
+	FileStart(f *File)
+	// FileProgress reports n bytes of f copied since previous notification
+	FileProgress(f *File, n uint64)
+	FileDone(f *File, err error)
+}
+
+// CopyFile copies exactly f.Size bytes from src to dst using buf, and reports progress to p, if it is not nil
+func CopyFile(dst io.Writer, src io.Reader, f *File, buf []byte, p Progress) error {
+	return copyFile(context.Background(), dst, src, f, buf, p)
+}
+
+func copyFile(ctx context.Context, dst io.Writer, src io.Reader, f *File, buf []byte, p Progress) (err error) {
+	if p != nil {
+		p.FileStart(f)
+		defer func() {
+			p.FileDone(f, err)
+		}()
+	}
+	// copy of io.copyBuffer, without WriterTo and ReaderFrom, with progress
+	src = io.LimitReader(src, int64(f.Size))
+	written := uint64(0)
+	for {
+		if err = checkContext(ctx, f.Name); err != nil {
+			break
+		}
+		nr, er := src.Read(buf)
+		if nr > 0 {
+			nw, ew := dst.Write(buf[0:nr])
+			if nw < 0 || nr < nw {
+				nw = 0
+				if ew == nil {
+					ew = errors.New("invalid write result")
+				}
+			}
+			written += uint64(nw)
+			if p != nil && nw > 0 {
+				p.FileProgress(f, uint64(nw))
+			}
+			if ew != nil {
+				err = ew
+				break
+			}
+			if nr != nw {
+				err = io.ErrShortWrite
+				break
+			}
+		}
+		if er != nil {
+			if er != io.EOF {
+				err = er
+			}
+			break
+		}
+	}
+	if err == nil && written < f.Size {
+		err = io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,111 @@
+package rawpack
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// recordingProgress records notifications of Progress, it may be used concurrently
+type recordingProgress struct {
+	mu      sync.Mutex
+	starts  int
+	files   int
+	active  map[string]bool
+	copied  map[string]uint64
+	done    map[string]error
+	invalid []string
+}
+
+func newRecordingProgress() *recordingProgress {
+	return &recordingProgress{active: map[string]bool{}, copied: map[string]uint64{}, done: map[string]error{}}
+}
+
+func (p *recordingProgress) Start(ft FileTable) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.starts++
+	p.files += len(ft)
+}
+
+func (p *recordingProgress) FileStart(f *File) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.active[f.Name] {
+		p.invalid = append(p.invalid, "FileStart twice: "+f.Name)
+	}
+	p.active[f.Name] = true
+}
+
+func (p *recordingProgress) FileProgress(f *File, n uint64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.active[f.Name] {
+		p.invalid = append(p.invalid, "FileProgress before FileStart: "+f.Name)
+	}
+	p.copied[f.Name] += n
+}
+
+func (p *recordingProgress) FileDone(f *File, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.active[f.Name] {
+		p.invalid = append(p.invalid, "FileDone before FileStart: "+f.Name)
+	}
+	p.active[f.Name] = false
+	p.done[f.Name] = err
+}
+
+// check checks, that all files are reported copied completely
+func (p *recordingProgress) check(t *testing.T, starts int, files map[string]string) {
+	t.Helper()
+	for _, it := range p.invalid {
+		t.Error(it)
+	}
+	if p.starts != starts || p.files != len(files) {
+		t.Errorf("Start is called %d times with %d files, want %d times with %d files", p.starts, p.files, starts, len(files))
+	}
+	for name, content := range files {
+		if err, ok := p.done[name]; !ok || err != nil {
+			t.Errorf("%s: FileDone is not called or failed: %v", name, err)
+		}
+		if p.copied[name] != uint64(len(content)) {
+			t.Errorf("%s: progress %d, want %d", name, p.copied[name], len(content))
+		}
+	}
+}
+
+func TestProgress(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, testFiles)
+	p := newRecordingProgress()
+	var buf bytes.Buffer
+	if err := PackDir(context.Background(), &buf, root, Options{Progress: p, BufferSize: 100}); err != nil {
+		t.Fatal(err)
+	}
+	p.check(t, 1, testFiles)
+
+	for _, jobs := range []int{1, 4} {
+		p = newRecordingProgress()
+		if err := Extract(context.Background(), bytes.NewReader(buf.Bytes()), t.TempDir(), Options{Progress: p, Jobs: jobs, BufferSize: 100}); err != nil {
+			t.Fatal(err)
+		}
+		p.check(t, 1, testFiles)
+	}
+}
+
+func TestCopyFileShort(t *testing.T) {
+	p := newRecordingProgress()
+	f := &File{Name: "a", Size: 10}
+	err := CopyFile(io.Discard, strings.NewReader("short"), f, make([]byte, 2), p)
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("got %v, want io.ErrUnexpectedEOF", err)
+	}
+	if p.copied["a"] != 5 || !errors.Is(p.done["a"], io.ErrUnexpectedEOF) {
+		t.Errorf("progress %d, FileDone %v", p.copied["a"], p.done["a"])
+	}
+}
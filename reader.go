@@ -2,12 +2,18 @@ package rawpack
 
 import (
 	"encoding/binary"
+	"fmt"
 	"io"
 	"strings"
 )
 
 type Reader struct {
-	in io.Reader
+	in     io.Reader
+	pos    int64
+	closer io.Closer
+	flags  FormatFlag
+	// dict is ZSTD dictionary of archive, it is set to files of read tables
+	dict []byte
 }
 
 func NewReader(in io.Reader) *Reader {
@@ -17,10 +23,8 @@ func NewReader(in io.Reader) *Reader {
 }
 
 func (r *Reader) read(b []byte) (int, error) {
-	n, err := r.in.Read(b)
-	if err == nil && n < len(b) {
-		err = io.ErrUnexpectedEOF
-	}
+	n, err := io.ReadFull(r.in, b)
+	r.pos += int64(n)
 	return n, err
 }
 
@@ -33,6 +37,25 @@ func (r *Reader) readUint64() (v uint64, err error) {
 	return
 }
 
+func (r *Reader) readBytes() ([]byte, error) {
+	l, err := r.readUint64()
+	if err != nil {
+		return nil, err
+	}
+	// length is not trusted for allocation, data is read by parts
+	var b []byte
+	var buf [256]byte
+	for l > 0 {
+		n, err := r.read(buf[:min(uint64(len(buf)), l)])
+		if err != nil {
+			return nil, err
+		}
+		b = append(b, buf[:n]...)
+		l -= uint64(n)
+	}
+	return b, nil
+}
+
 func (r *Reader) readString() (string, error) {
 	var buf [256]byte
 	var sb strings.Builder
@@ -59,12 +82,37 @@ func (r *Reader) readFileInfo(f *File) error {
 	}
 	f.Name = name
 	f.Size = size
+	if r.flags&FlagExtensions != 0 {
+		return r.readExtensions(f)
+	}
 	return nil
 }
 
+func (r *Reader) readExtensions(f *File) error {
+	n, err := r.readUint64()
+	if err != nil {
+		return err
+	}
+	f.Extensions = nil
+	for ; n > 0; n-- {
+		key, err := r.readString()
+		if err != nil {
+			return err
+		}
+		value, err := r.readBytes()
+		if err != nil {
+			return err
+		}
+		f.Extensions = append(f.Extensions, Extension{Key: key, Value: value})
+	}
+	return nil
+}
+
+// ReadSignature reads signature, its flags define format of file table
 func (r *Reader) ReadSignature() (Signature, error) {
 	var s Signature
 	_, err := r.read(s[:])
+	r.flags = s.Flags()
 	return s, err
 }
 
@@ -76,10 +124,30 @@ func (r *Reader) ReadFileTable() (FileTable, error) {
 			if err := r.readFileInfo(&ft[i]); err != nil {
 				return nil, err
 			}
+			ft[i].dict = r.dict
 		}
 		return ft, nil
 	}
-	return nil, nil
+	return nil, err
+}
+
+// NextFileTable reads signature and file table of the next segment of archive (see Appender),
+// after all files of the previous table are read. io.EOF is returned at the end of archive.
+func (r *Reader) NextFileTable() (FileTable, error) {
+	var s Signature
+	n, err := r.read(s[:])
+	if n == 0 && err == io.EOF {
+		return nil, io.EOF
+	} else if err == io.EOF {
+		return nil, io.ErrUnexpectedEOF
+	} else if err != nil {
+		return nil, err
+	}
+	if !s.IsValid() {
+		return nil, fmt.Errorf("%w after end of archive: %q", ErrInvalidSignature, string(s[:]))
+	}
+	r.flags = s.Flags()
+	return r.ReadFileTable()
 }
 
 func (r *Reader) ReadFile(f *File) io.Reader {
@@ -90,5 +158,20 @@ func (r *Reader) ReadFile(f *File) io.Reader {
 }
 
 func (r *Reader) Read(b []byte) (int, error) {
-	return r.in.Read(b)
+	n, err := r.in.Read(b)
+	r.pos += int64(n)
+	return n, err
+}
+
+// Close releases decompressor of archive opened by OpenReader, underlying reader is not closed
+func (r *Reader) Close() error {
+	if r.closer == nil {
+		return nil
+	}
+	return r.closer.Close()
+}
+
+// Offset returns count of bytes read from underlying reader
+func (r *Reader) Offset() int64 {
+	return r.pos
 }
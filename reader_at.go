@@ -0,0 +1,62 @@
+package rawpack
+
+import (
+	"fmt"
+	"io"
+)
+
+// ReaderAt provides random access to files of archive,
+// offsets of files are computed from file table
+type ReaderAt struct {
+	in      io.ReaderAt
+	ft      FileTable
+	offsets []int64
+}
+
+// NewReaderAt reads file tables of all segments of archive, see Appender
+func NewReaderAt(in io.ReaderAt, size int64) (*ReaderAt, error) {
+	return newReaderAt(in, size, nil)
+}
+
+// newReaderAt reads file tables of archive, files of which use ZSTD dictionary dict
+func newReaderAt(in io.ReaderAt, size int64, dict []byte) (*ReaderAt, error) {
+	ra := &ReaderAt{in: in}
+	for start := int64(0); start == 0 || start < size; {
+		r := NewReader(io.NewSectionReader(in, start, size-start))
+		r.dict = dict
+		s, err := r.ReadSignature()
+		if err != nil {
+			return nil, err
+		}
+		if !s.IsValid() {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidSignature, string(s[:]))
+		}
+		ft, err := r.ReadFileTable()
+		if err != nil {
+			return nil, err
+		}
+		offset := start + r.Offset()
+		for _, it := range ft {
+			ra.offsets = append(ra.offsets, offset)
+			offset += int64(it.Size)
+		}
+		if offset > size {
+			return nil, fmt.Errorf("archive is truncated: expected %d bytes, got %d", offset, size)
+		}
+		ra.ft = append(ra.ft, ft...)
+		start = offset
+	}
+	return ra, nil
+}
+
+func (r *ReaderAt) FileTable() FileTable {
+	return r.ft
+}
+
+func (r *ReaderAt) Offset(i int) int64 {
+	return r.offsets[i]
+}
+
+func (r *ReaderAt) Open(i int) *io.SectionReader {
+	return io.NewSectionReader(r.in, r.offsets[i], int64(r.ft[i].Size))
+}
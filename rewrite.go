@@ -0,0 +1,202 @@
+package rawpack
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+)
+
+// ErrNotModified is returned by Rewrite, when edit doesn't change any file, nothing is written then
+var ErrNotModified = errors.New("archive is not modified")
+
+// detectArchive detects compression of archive in r, which must agree with opts,
+// and reads ZSTD dictionary stored at its start
+func detectArchive(r io.ReaderAt, opts *Options) (Codec, []byte, error) {
+	magic := make([]byte, len(s2Magic))
+	n, _ := r.ReadAt(magic, 0)
+	codec := detectCodec(magic[:n])
+	prefix, err := readDictPrefix(r)
+	if err != nil {
+		return codec, nil, err
+	}
+	if prefix != nil {
+		// uncompressed archive with files compressed separately
+		codec = CodecNone
+	}
+	switch {
+	case codec == CodecXz:
+		return codec, nil, fmt.Errorf("%w: %s", ErrUnsupportedCodec, codec)
+	case codec == CodecNone && opts.Codec == CodecFlate:
+		// flate stream has no magic
+		return CodecFlate, nil, nil
+	case opts.Zstd != nil && opts.EntryCodec == CodecNone && codec != CodecZstd:
+		return codec, nil, errors.New("archive is not compressed with ZSTD")
+	case opts.Codec != CodecNone && opts.Codec != codec:
+		return codec, nil, fmt.Errorf("archive is not compressed with %s", opts.Codec)
+	}
+	if codec != CodecZstd || !isSkippableFrame(magic) {
+		return codec, prefix, nil
+	}
+	d, err := readDictFrame(io.NewSectionReader(r, 4, math.MaxInt64-4))
+	return codec, d, err
+}
+
+// Rewrite writes archive of size from r to w, with files changed by edit. edit is called for every file
+// of all segments in order, before anything is written; it returns false to remove file, and may change its name.
+// ErrNotModified is returned, if no file is changed.
+// Segments are joined into one. Stored data of files is copied as is, so files compressed separately are not
+// compressed again. Compression, ZSTD dictionary and encryption with opts.Key of whole archive are kept,
+// but data of compressed or encrypted archive is processed again. Parameters of ZSTD are not stored in archive,
+// it is compressed again with opts.Zstd or with automatic parameters, if it is nil.
+func Rewrite(ctx context.Context, w io.Writer, r io.ReaderAt, size int64, opts Options, edit func(f *File) (bool, error)) (err error) {
+	codec, dict, err := detectArchive(r, &opts)
+	if err != nil {
+		return err
+	}
+	read := Options{Codec: codec, Key: opts.Key, WriteSpeed: opts.WriteSpeed}
+	write := Options{Codec: codec, ZstdDict: dict, Key: opts.Key, BufferSize: opts.BufferSize, WriteSpeed: opts.WriteSpeed}
+	if codec == CodecZstd {
+		write.Zstd = opts.Zstd
+		if write.Zstd == nil {
+			write.Zstd, _ = ParseZstdOptions("")
+		}
+	}
+
+	// file table is read before files, uncompressed archive has offsets of files in it
+	var ra *ReaderAt
+	var ft FileTable
+	var segments []int
+	if codec == CodecNone {
+		if ra, err = OpenReaderAt(r, size, read); err != nil {
+			return err
+		}
+		ft = ra.FileTable()
+	} else if ft, segments, err = readFileTables(ctx, io.NewSectionReader(r, 0, size), read); err != nil {
+		return err
+	}
+	keep := make([]bool, len(ft))
+	var edited FileTable
+	for i := range ft {
+		f := ft[i]
+		if keep[i], err = edit(&f); err != nil {
+			return err
+		}
+		if keep[i] {
+			edited = append(edited, f)
+		}
+	}
+	if slices.EqualFunc(ft, edited, equalFiles) {
+		return ErrNotModified
+	}
+
+	if dict != nil {
+		if err := writeDictFrame(w, dict); err != nil {
+			return err
+		}
+	}
+	w, c, err := write.wrapWriter(w, edited.archiveSize(), dict)
+	if err != nil {
+		return err
+	}
+	if c != nil {
+		defer closeOnReturn(c, &err)
+	}
+	if write.Key != nil {
+		w = newCryptoWriterAt(w, write.Key, 0)
+	}
+	archive := NewWriter(w)
+	err = archive.WriteSignature(NewSignature().WithFlags(edited.flags()))
+	if err == nil {
+		err = archive.WriteFileTable(edited)
+	}
+	if err != nil {
+		return err
+	}
+	if opts.Progress != nil {
+		opts.Progress.Start(edited)
+	}
+
+	buf := opts.buffer()
+	if ra != nil {
+		j := 0
+		for i := range ft {
+			if !keep[i] {
+				continue
+			}
+			if err := copyFile(ctx, archive, ra.Open(i), &edited[j], buf, opts.Progress); err != nil {
+				return err
+			}
+			j++
+		}
+		return nil
+	}
+
+	// compressed archive is read again, tables of appended segments are skipped
+	in, _, err := OpenReader(io.NewSectionReader(r, 0, size), read)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	i, j := 0, 0
+	for s, n := range segments {
+		if s > 0 {
+			if _, err := in.NextFileTable(); err != nil {
+				return err
+			}
+		}
+		for end := i + n; i < end; i++ {
+			if err := checkContext(ctx, ""); err != nil {
+				return err
+			}
+			src := in.ReadFile(&ft[i])
+			if keep[i] {
+				if err := copyFile(ctx, archive, src, &edited[j], buf, opts.Progress); err != nil {
+					return err
+				}
+				j++
+			} else if _, err := io.CopyBuffer(io.Discard, src, buf); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func equalFiles(a, b File) bool {
+	return a.Name == b.Name && a.Size == b.Size && slices.EqualFunc(a.Extensions, b.Extensions, func(a, b Extension) bool {
+		return a.Key == b.Key && bytes.Equal(a.Value, b.Value)
+	})
+}
+
+// readFileTables reads file tables of all segments of archive sequentially,
+// returns joined table and counts of files in segments
+func readFileTables(ctx context.Context, r io.Reader, opts Options) (FileTable, []int, error) {
+	archive, ft, err := OpenReader(r, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer archive.Close()
+	var all FileTable
+	var segments []int
+	buf := opts.buffer()
+	for ; err == nil; ft, err = archive.NextFileTable() {
+		all = append(all, ft...)
+		segments = append(segments, len(ft))
+		for i := range ft {
+			if err := checkContext(ctx, ""); err != nil {
+				return nil, nil, err
+			}
+			if _, err := io.CopyBuffer(io.Discard, archive.ReadFile(&ft[i]), buf); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+	if err != io.EOF {
+		return nil, nil, err
+	}
+	return all, segments, nil
+}
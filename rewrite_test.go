@@ -0,0 +1,94 @@
+package rawpack
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"maps"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestRewriteRoundTrip(t *testing.T) {
+	more := map[string]string{"sub/e.txt": "epsilon"}
+	forEachCodec(t, func(t *testing.T, opts Options) {
+		ctx := context.Background()
+		// archive has two segments
+		p := packTestArchive(t, opts)
+		a, err := OpenAppend(ctx, p, Options{Key: opts.Key, EntryCodec: opts.EntryCodec})
+		if err != nil {
+			t.Fatal(err)
+		}
+		root := t.TempDir()
+		writeTree(t, root, more)
+		if err := a.PackDir(ctx, root); err != nil {
+			t.Fatal(err)
+		}
+		if err := a.Close(); err != nil {
+			t.Fatal(err)
+		}
+		src, err := os.ReadFile(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := bytes.NewReader(src)
+
+		var out bytes.Buffer
+		err = Rewrite(ctx, &out, r, r.Size(), Options{Key: opts.Key}, func(f *File) (bool, error) { return true, nil })
+		if !errors.Is(err, ErrNotModified) || out.Len() != 0 {
+			t.Errorf("Rewrite without changes: %v, %d bytes written", err, out.Len())
+		}
+		errEdit := errors.New("edit")
+		err = Rewrite(ctx, &out, r, r.Size(), Options{Key: opts.Key}, func(f *File) (bool, error) { return true, errEdit })
+		if !errors.Is(err, errEdit) || out.Len() != 0 {
+			t.Errorf("Rewrite with failed edit: %v, %d bytes written", err, out.Len())
+		}
+
+		// b.log is deleted, sub is renamed to dir, files of both segments are changed
+		err = Rewrite(ctx, &out, r, r.Size(), Options{Key: opts.Key}, func(f *File) (bool, error) {
+			if f.Name == "b.log" {
+				return false, nil
+			}
+			if rest, ok := strings.CutPrefix(f.Name, "sub/"); ok {
+				f.Name = "dir/" + rest
+			}
+			return true, nil
+		})
+		if err != nil {
+			t.Fatalf("Rewrite: %v", err)
+		}
+		want := maps.Clone(testFiles)
+		maps.Copy(want, more)
+		delete(want, "b.log")
+		for _, it := range []string{"sub/c.txt", "sub/deep/d.go", "sub/e.txt"} {
+			want["dir/"+it[len("sub/"):]] = want[it]
+			delete(want, it)
+		}
+
+		// segments are joined into one
+		in, ft, err := OpenReader(bytes.NewReader(out.Bytes()), Options{Key: opts.Key})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(ft) != len(want) {
+			t.Errorf("file table has %d files, want %d", len(ft), len(want))
+		}
+		for i := range ft {
+			if _, err := io.Copy(io.Discard, in.ReadFile(&ft[i])); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, err := in.NextFileTable(); err != io.EOF {
+			t.Errorf("NextFileTable: %v, want io.EOF", err)
+		}
+		in.Close()
+
+		dest := t.TempDir()
+		if err := Extract(ctx, bytes.NewReader(out.Bytes()), dest, Options{Key: opts.Key}); err != nil {
+			t.Fatalf("Extract: %v", err)
+		}
+		checkTree(t, dest, want)
+	})
+}
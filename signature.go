@@ -2,18 +2,39 @@ package rawpack
 
 import (
 	"bytes"
+	"errors"
 )
 
+// FormatFlag is stored in the last byte of signature and describes features used by archive
 type FormatFlag byte
 
+const (
+	// FlagExtensions means, that each entry of file table has list of extensions
+	FlagExtensions FormatFlag = 1 << iota
+
+	knownFlags = FlagExtensions
+)
+
 const (
 	signaturePrefix = "RAW PACK FORMAT\u0000"
 )
 
+var ErrInvalidSignature = errors.New("invalid rawpack signature")
+
 type Signature [16]byte
 
 func (s Signature) IsValid() bool {
-	return bytes.Equal(s[:], []byte(signaturePrefix))
+	return bytes.Equal(s[:len(s)-1], []byte(signaturePrefix[:len(s)-1])) && s.Flags()&^knownFlags == 0
+}
+
+func (s Signature) Flags() FormatFlag {
+	return FormatFlag(s[len(s)-1])
+}
+
+// WithFlags returns signature with flags set
+func (s Signature) WithFlags(f FormatFlag) Signature {
+	s[len(s)-1] |= byte(f)
+	return s
 }
 
 func NewSignature() (s Signature) {
@@ -0,0 +1,289 @@
+package rawpack
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// ExtSparse is key of extension with sparse map of file
+const ExtSparse = "rpk.sparse"
+
+// SparseSegment is region of sparse file with data, other regions are holes
+type SparseSegment struct {
+	Offset uint64
+	Length uint64
+}
+
+// SparseMap describes sparse file: only its data segments are stored in archive, in order of offsets
+type SparseMap struct {
+	// Size is size of file with holes
+	Size uint64
+	Data []SparseSegment
+}
+
+func (m *SparseMap) stored() (n uint64) {
+	for _, it := range m.Data {
+		n += it.Length
+	}
+	return
+}
+
+func (m *SparseMap) encode() []byte {
+	b := make([]byte, 0, 16+16*len(m.Data))
+	b = binary.LittleEndian.AppendUint64(b, m.Size)
+	b = binary.LittleEndian.AppendUint64(b, uint64(len(m.Data)))
+	for _, it := range m.Data {
+		b = binary.LittleEndian.AppendUint64(b, it.Offset)
+		b = binary.LittleEndian.AppendUint64(b, it.Length)
+	}
+	return b
+}
+
+func decodeSparseMap(b []byte) (*SparseMap, error) {
+	invalid := errors.New("invalid sparse map")
+	if len(b) < 16 {
+		return nil, invalid
+	}
+	m := &SparseMap{Size: binary.LittleEndian.Uint64(b)}
+	n := binary.LittleEndian.Uint64(b[8:])
+	b = b[16:]
+	// count is checked by division, so it doesn't overflow
+	if uint64(len(b))%16 != 0 || uint64(len(b))/16 != n {
+		return nil, invalid
+	}
+	m.Data = make([]SparseSegment, n)
+	end := uint64(0)
+	for i := range m.Data {
+		m.Data[i] = SparseSegment{
+			Offset: binary.LittleEndian.Uint64(b[16*i:]),
+			Length: binary.LittleEndian.Uint64(b[16*i+8:]),
+		}
+		if it := m.Data[i]; it.Offset < end || it.Offset+it.Length < it.Offset || it.Offset+it.Length > m.Size {
+			return nil, invalid
+		}
+		end = m.Data[i].Offset + m.Data[i].Length
+	}
+	return m, nil
+}
+
+// SparseMap returns sparse map of file, or nil if file is not sparse
+func (f *File) SparseMap() (*SparseMap, error) {
+	b, ok := f.Extension(ExtSparse)
+	if !ok {
+		return nil, nil
+	}
+	m, err := decodeSparseMap(b)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", f.Name, err)
+	}
+	if m.stored() != f.dataSize() {
+		return nil, fmt.Errorf("%s: sparse map doesn't match size of file", f.Name)
+	}
+	return m, nil
+}
+
+// ContentSize returns size of file after extraction, it differs from Size for sparse and compressed files
+func (f *File) ContentSize() uint64 {
+	if m, err := f.SparseMap(); err == nil && m != nil {
+		return m.Size
+	}
+	return f.dataSize()
+}
+
+// setSparse stores only data segments of file, if it has holes
+func (f *File) setSparse(m *SparseMap) {
+	if m == nil || m.stored() == m.Size {
+		return
+	}
+	f.Size = m.stored()
+	f.SetExtension(ExtSparse, m.encode())
+}
+
+// detectSparse sets sparse map of regular file f with holes
+func detectSparse(f *File, p string, size int64) error {
+	file, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	m, err := findSparseMap(file, size)
+	if err != nil {
+		return fmt.Errorf("%s: %w", f.Name, err)
+	}
+	f.setSparse(m)
+	return nil
+}
+
+// sparseDataReader reads data segments of sparse file one after another
+type sparseDataReader struct {
+	f *os.File
+	r io.Reader
+}
+
+func newSparseDataReader(f *os.File, m *SparseMap) *sparseDataReader {
+	readers := make([]io.Reader, len(m.Data))
+	for i, it := range m.Data {
+		readers[i] = io.NewSectionReader(f, int64(it.Offset), int64(it.Length))
+	}
+	return &sparseDataReader{f: f, r: io.MultiReader(readers...)}
+}
+
+func (r *sparseDataReader) Read(b []byte) (int, error) {
+	return r.r.Read(b)
+}
+
+func (r *sparseDataReader) Close() error {
+	return r.f.Close()
+}
+
+// sparseWriter writes data segments of sparse file to their offsets, holes are skipped by seeking
+type sparseWriter struct {
+	w    io.WriteSeeker
+	data []SparseSegment
+	left uint64
+}
+
+func (w *sparseWriter) Write(b []byte) (n int, err error) {
+	for len(b) > 0 {
+		for w.left == 0 {
+			if len(w.data) == 0 {
+				return n, errors.New("data exceeds sparse map")
+			}
+			if _, err := w.w.Seek(int64(w.data[0].Offset), io.SeekStart); err != nil {
+				return n, err
+			}
+			w.left = w.data[0].Length
+			w.data = w.data[1:]
+		}
+		part := b[:min(uint64(len(b)), w.left)]
+		m, err := w.w.Write(part)
+		n += m
+		w.left -= uint64(m)
+		if err != nil {
+			return n, err
+		}
+		b = b[m:]
+	}
+	return n, nil
+}
+
+// sparseReaderAt reads content of sparse file, holes are read as zeros
+type sparseReaderAt struct {
+	data io.ReaderAt
+	m    *SparseMap
+	// offsets of segments in data
+	offsets []int64
+}
+
+func newSparseReaderAt(data io.ReaderAt, m *SparseMap) *sparseReaderAt {
+	r := &sparseReaderAt{data: data, m: m, offsets: make([]int64, len(m.Data))}
+	offset := int64(0)
+	for i, it := range m.Data {
+		r.offsets[i] = offset
+		offset += int64(it.Length)
+	}
+	return r
+}
+
+func (r *sparseReaderAt) ReadAt(b []byte, off int64) (n int, err error) {
+	if off >= int64(r.m.Size) {
+		return 0, io.EOF
+	}
+	if rest := int64(r.m.Size) - off; int64(len(b)) > rest {
+		b = b[:rest]
+		err = io.EOF
+	}
+	clear(b)
+	for i, it := range r.m.Data {
+		start, end := max(off, int64(it.Offset)), min(off+int64(len(b)), int64(it.Offset+it.Length))
+		if start >= end {
+			continue
+		}
+		if _, e := r.data.ReadAt(b[start-off:end-off], r.offsets[i]+start-int64(it.Offset)); e != nil && e != io.EOF {
+			return int(start - off), e
+		}
+	}
+	return len(b), err
+}
+
+// sparseContentReader expands data segments of sparse file read sequentially, holes are read as zeros
+type sparseContentReader struct {
+	r    io.Reader
+	m    *SparseMap
+	pos  uint64
+	next int
+}
+
+func (r *sparseContentReader) Read(b []byte) (int, error) {
+	if r.pos >= r.m.Size {
+		return 0, io.EOF
+	}
+	b = b[:min(uint64(len(b)), r.m.Size-r.pos)]
+	if r.next < len(r.m.Data) {
+		it := r.m.Data[r.next]
+		if r.pos < it.Offset {
+			b = b[:min(uint64(len(b)), it.Offset-r.pos)]
+			clear(b)
+			r.pos += uint64(len(b))
+			return len(b), nil
+		}
+		b = b[:min(uint64(len(b)), it.Offset+it.Length-r.pos)]
+		n, err := r.r.Read(b)
+		r.pos += uint64(n)
+		if r.pos == it.Offset+it.Length {
+			r.next++
+		}
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return n, err
+	}
+	clear(b)
+	r.pos += uint64(len(b))
+	return len(b), nil
+}
+
+// NewContentReader returns reader of content of file f, which data is read from r.
+// Holes of sparse file are read as zeros, file compressed separately is decompressed,
+// and rest of its stored bytes in r must be skipped by caller. Other files are read as is.
+func NewContentReader(r io.Reader, f *File) (io.Reader, error) {
+	m, err := f.SparseMap()
+	if err != nil {
+		return nil, err
+	}
+	if r, err = openEntry(r, f); err != nil {
+		return nil, err
+	}
+	if m == nil {
+		return r, nil
+	}
+	return &sparseContentReader{r: r, m: m}, nil
+}
+
+// OpenContent returns reader of content of i-th file at random positions, holes of sparse file are read as zeros.
+// ErrNotSeekable is returned for file compressed separately, it is read by OpenStream.
+func (r *ReaderAt) OpenContent(i int) (*io.SectionReader, error) {
+	f := &r.ft[i]
+	m, err := f.SparseMap()
+	if err != nil {
+		return nil, err
+	}
+	if c, _, err := f.EntryCodec(); err != nil {
+		return nil, err
+	} else if c != CodecNone {
+		return nil, fmt.Errorf("%s: %w", f.Name, ErrNotSeekable)
+	}
+	if m == nil {
+		return r.Open(i), nil
+	}
+	return io.NewSectionReader(newSparseReaderAt(r.Open(i), m), 0, int64(m.Size)), nil
+}
+
+// OpenStream returns reader of content of i-th file from its start, like NewContentReader,
+// file compressed separately is decompressed while it is read
+func (r *ReaderAt) OpenStream(i int) (io.Reader, error) {
+	return NewContentReader(r.Open(i), &r.ft[i])
+}
@@ -0,0 +1,37 @@
+package rawpack
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// findSparseMap finds data segments of file with SEEK_DATA and SEEK_HOLE,
+// returns nil if file system doesn't support them
+func findSparseMap(f *os.File, size int64) (*SparseMap, error) {
+	fd := int(f.Fd())
+	m := &SparseMap{Size: uint64(size)}
+	for off := int64(0); off < size; {
+		data, err := unix.Seek(fd, off, unix.SEEK_DATA)
+		if errors.Is(err, unix.ENXIO) {
+			// the rest of file is hole
+			break
+		} else if errors.Is(err, unix.EINVAL) || errors.Is(err, unix.EOPNOTSUPP) {
+			return nil, nil
+		} else if err != nil {
+			return nil, err
+		}
+		hole, err := unix.Seek(fd, data, unix.SEEK_HOLE)
+		if err != nil {
+			return nil, err
+		}
+		hole = min(hole, size)
+		if data >= hole {
+			break
+		}
+		m.Data = append(m.Data, SparseSegment{Offset: uint64(data), Length: uint64(hole - data)})
+		off = hole
+	}
+	return m, nil
+}
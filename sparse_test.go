@@ -0,0 +1,167 @@
+package rawpack
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSparseMapRoundTrip(t *testing.T) {
+	maps := []*SparseMap{
+		{Size: 0, Data: []SparseSegment{}},
+		{Size: 100, Data: []SparseSegment{}},
+		{Size: 100, Data: []SparseSegment{{Offset: 0, Length: 10}}},
+		{Size: 1 << 40, Data: []SparseSegment{{Offset: 4096, Length: 4096}, {Offset: 1<<40 - 10, Length: 10}}},
+	}
+	for _, m := range maps {
+		got, err := decodeSparseMap(m.encode())
+		if err != nil {
+			t.Errorf("decodeSparseMap(%+v): %v", m, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, m) {
+			t.Errorf("decoded %+v, want %+v", got, m)
+		}
+	}
+}
+
+func TestSparseMapInvalid(t *testing.T) {
+	encode := func(values ...uint64) []byte {
+		var b []byte
+		for _, it := range values {
+			b = binary.LittleEndian.AppendUint64(b, it)
+		}
+		return b
+	}
+	tests := map[string][]byte{
+		"short":        {1, 2, 3},
+		"count":        encode(100, 2, 0, 10),
+		"beyond size":  encode(100, 1, 90, 20),
+		"overlapping":  encode(100, 2, 0, 10, 5, 10),
+		"unordered":    encode(100, 2, 50, 10, 0, 10),
+		"overflow":     encode(100, 1, 10, ^uint64(0)),
+		"trailing":     append(encode(100, 0), 0),
+		"huge count":   encode(100, 1<<60),
+		"no size only": encode(100),
+	}
+	for name, b := range tests {
+		if _, err := decodeSparseMap(b); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestFileSparseMapSize(t *testing.T) {
+	m := &SparseMap{Size: 100, Data: []SparseSegment{{Offset: 10, Length: 5}}}
+	f := File{Name: "a", Size: 6}
+	f.SetExtension(ExtSparse, m.encode())
+	if _, err := f.SparseMap(); err == nil {
+		t.Error("expected error for stored size different from sparse map")
+	}
+	f.Size = 5
+	if got := f.ContentSize(); got != 100 {
+		t.Errorf("ContentSize() = %d, want 100", got)
+	}
+}
+
+// sparseContent returns content of sparse file with map m and data, holes are zeros
+func sparseContent(m *SparseMap, data []byte) []byte {
+	b := make([]byte, m.Size)
+	for _, it := range m.Data {
+		copy(b[it.Offset:], data[:it.Length])
+		data = data[it.Length:]
+	}
+	return b
+}
+
+var testSparseMaps = []*SparseMap{
+	{Size: 20},
+	{Size: 20, Data: []SparseSegment{{Offset: 0, Length: 20}}},
+	{Size: 20, Data: []SparseSegment{{Offset: 0, Length: 3}}},
+	{Size: 20, Data: []SparseSegment{{Offset: 17, Length: 3}}},
+	{Size: 20, Data: []SparseSegment{{Offset: 2, Length: 3}, {Offset: 5, Length: 1}, {Offset: 10, Length: 4}}},
+}
+
+func TestSparseContentReader(t *testing.T) {
+	for _, m := range testSparseMaps {
+		data := bytes.Repeat([]byte{'x'}, int(m.stored()))
+		for i := range data {
+			data[i] = byte('a' + i)
+		}
+		f := File{Name: "a", Size: m.stored()}
+		f.SetExtension(ExtSparse, m.encode())
+		r, err := NewContentReader(bytes.NewReader(data), &f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// small reads cross boundaries of segments
+		got, err := io.ReadAll(io.LimitReader(&oneByteReader{r}, 1<<20))
+		if err != nil {
+			t.Fatalf("%+v: %v", m, err)
+		}
+		if want := sparseContent(m, data); !bytes.Equal(got, want) {
+			t.Errorf("%+v: got %q, want %q", m, got, want)
+		}
+
+		ra := newSparseReaderAt(bytes.NewReader(data), m)
+		want := sparseContent(m, data)
+		for off := 0; off <= len(want); off++ {
+			for n := 0; off+n <= len(want); n++ {
+				b := make([]byte, n)
+				if _, err := ra.ReadAt(b, int64(off)); err != nil && err != io.EOF {
+					t.Fatalf("%+v: ReadAt(%d, %d): %v", m, n, off, err)
+				}
+				if !bytes.Equal(b, want[off:off+n]) {
+					t.Errorf("%+v: ReadAt(%d, %d) = %q, want %q", m, n, off, b, want[off:off+n])
+				}
+			}
+		}
+	}
+}
+
+type oneByteReader struct {
+	r io.Reader
+}
+
+func (r *oneByteReader) Read(b []byte) (int, error) {
+	if len(b) == 0 {
+		return 0, nil
+	}
+	return r.r.Read(b[:1])
+}
+
+func TestSparseWriter(t *testing.T) {
+	for _, m := range testSparseMaps {
+		data := make([]byte, m.stored())
+		for i := range data {
+			data[i] = byte('a' + i)
+		}
+		p := filepath.Join(t.TempDir(), "f")
+		file, err := os.Create(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := &sparseWriter{w: file, data: m.Data}
+		if _, err := io.Copy(w, &oneByteReader{bytes.NewReader(data)}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte{0}); err == nil {
+			t.Errorf("%+v: expected error for data beyond sparse map", m)
+		}
+		if err := file.Truncate(int64(m.Size)); err != nil {
+			t.Fatal(err)
+		}
+		_ = file.Close()
+		got, err := os.ReadFile(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := sparseContent(m, data); !bytes.Equal(got, want) {
+			t.Errorf("%+v: got %q, want %q", m, got, want)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package rawpack
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"sync"
+)
+
+// spooler stores contents of files with unknown size (FIFOs, stdin, /proc and /sys files)
+// in temporary files, so the size is known before the file table is written
+type spooler struct {
+	mu    sync.Mutex
+	files []string
+}
+
+// isUnknownSize reports, whether length of contents of file at path p may differ from its size:
+// it is FIFO, or regular file of virtual file system, like /proc and /sys (detected only on Linux).
+// Results of checks of file systems are cached in virtual by devices.
+func isUnknownSize(p string, info fs.FileInfo, virtual map[uint64]bool) (bool, error) {
+	mode := info.Mode()
+	if mode&fs.ModeNamedPipe != 0 {
+		return true, nil
+	}
+	if !mode.IsRegular() {
+		return false, nil
+	}
+	return isVirtualFile(p, info, virtual)
+}
+
+func (s *spooler) spool(ctx context.Context, f *File, in io.Reader) (err error) {
+	in = &contextReader{ctx: ctx, name: f.Name, r: in}
+	var probe [4096]byte
+	n, err := io.ReadFull(in, probe[:])
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		if n == 0 {
+			// empty contents are not stored, and file is not read again
+			f.Path = os.DevNull
+			f.Size = 0
+			return nil
+		}
+	} else if err != nil {
+		return err
+	}
+
+	tmp, err := s.create()
+	if err != nil {
+		return err
+	}
+	defer closeOnReturn(tmp, &err)
+
+	if _, err := tmp.Write(probe[:n]); err != nil {
+		return err
+	}
+	size := uint64(n)
+	if n == len(probe) {
+		m, err := io.Copy(tmp, in)
+		if err != nil {
+			return err
+		}
+		size += uint64(m)
+	}
+	f.Path = tmp.Name()
+	f.Size = size
+	return nil
+}
+
+// create creates temporary file, which is removed by Close
+func (s *spooler) create() (*os.File, error) {
+	tmp, err := os.CreateTemp("", "rpk-*.spool")
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	s.files = append(s.files, tmp.Name())
+	s.mu.Unlock()
+	return tmp, nil
+}
+
+func (s *spooler) spoolFile(ctx context.Context, f *File) error {
+	rc, err := f.Read()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	return s.spool(ctx, f, rc)
+}
+
+func (s *spooler) Close() error {
+	var errs []error
+	for _, it := range s.files {
+		if err := os.Remove(it); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			errs = append(errs, err)
+		}
+	}
+	s.files = nil
+	return errors.Join(errs...)
+}
@@ -0,0 +1,33 @@
+package rawpack
+
+import (
+	"io/fs"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// isVirtualFile reports, whether regular file at path p is in virtual file system,
+// which reports sizes of files different from length of their contents
+func isVirtualFile(p string, info fs.FileInfo, virtual map[uint64]bool) (bool, error) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if ok {
+		if v, found := virtual[uint64(st.Dev)]; found {
+			return v, nil
+		}
+	}
+	var fsInfo unix.Statfs_t
+	if err := unix.Statfs(p, &fsInfo); err != nil {
+		return false, err
+	}
+	v := false
+	switch fsInfo.Type {
+	case unix.PROC_SUPER_MAGIC, unix.SYSFS_MAGIC, unix.DEBUGFS_MAGIC, unix.TRACEFS_MAGIC,
+		unix.SECURITYFS_MAGIC, unix.CGROUP_SUPER_MAGIC, unix.CGROUP2_SUPER_MAGIC:
+		v = true
+	}
+	if ok {
+		virtual[uint64(st.Dev)] = v
+	}
+	return v, nil
+}
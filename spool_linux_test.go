@@ -0,0 +1,68 @@
+package rawpack
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestPackDirFIFO(t *testing.T) {
+	root := t.TempDir()
+	fifo := filepath.Join(root, "fifo")
+	if err := syscall.Mkfifo(fifo, 0644); err != nil {
+		t.Skip("FIFO is not supported:", err)
+	}
+	content := strings.Repeat("from fifo\n", 1000)
+	go func() {
+		// opening blocks until FIFO is opened for reading by packer
+		f, err := os.OpenFile(fifo, os.O_WRONLY, 0)
+		if err != nil {
+			return
+		}
+		_, _ = f.WriteString(content)
+		_ = f.Close()
+	}()
+	var buf bytes.Buffer
+	if err := PackDir(context.Background(), &buf, root, Options{}); err != nil {
+		t.Fatal(err)
+	}
+	dest := t.TempDir()
+	if err := Extract(context.Background(), &buf, dest, Options{}); err != nil {
+		t.Fatal(err)
+	}
+	checkTree(t, dest, map[string]string{"fifo": content})
+}
+
+func TestPackDirVirtualFiles(t *testing.T) {
+	// stat sizes of files of procfs are 0, of sysfs are usually 4096
+	var files []string
+	for _, it := range []string{"/proc/self/cmdline", "/proc/version", "/sys/devices/system/cpu/online", "/sys/kernel/mm/transparent_hugepage/enabled"} {
+		if _, err := os.ReadFile(it); err == nil {
+			files = append(files, it)
+		}
+	}
+	if len(files) == 0 {
+		t.Skip("no files of procfs and sysfs")
+	}
+	var buf bytes.Buffer
+	if err := PackDir(context.Background(), &buf, "", Options{Files: files}); err != nil {
+		t.Fatal(err)
+	}
+	dest := t.TempDir()
+	if err := Extract(context.Background(), &buf, dest, Options{}); err != nil {
+		t.Fatal(err)
+	}
+	want := make(map[string]string)
+	for _, it := range files {
+		content, err := os.ReadFile(it)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want[strings.TrimPrefix(it, "/")] = string(content)
+	}
+	checkTree(t, dest, want)
+}
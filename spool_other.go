@@ -0,0 +1,10 @@
+//go:build !linux
+
+package rawpack
+
+import "io/fs"
+
+// isVirtualFile returns false, virtual file systems are detected only on Linux
+func isVirtualFile(p string, info fs.FileInfo, virtual map[uint64]bool) (bool, error) {
+	return false, nil
+}
@@ -0,0 +1,41 @@
+package rawpack
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestPackDirSources(t *testing.T) {
+	long := strings.Repeat("spooled source\n", 1000)
+	sources := []Source{
+		{Name: "empty", Reader: strings.NewReader("")},
+		// reader returns less than requested, and less than size of probe
+		{Name: "short", Reader: &oneByteReader{strings.NewReader("short")}},
+		{Name: "long", Reader: &oneByteReader{strings.NewReader(long)}},
+	}
+	var buf bytes.Buffer
+	if err := PackDir(context.Background(), &buf, "", Options{Sources: sources}); err != nil {
+		t.Fatal(err)
+	}
+	dest := t.TempDir()
+	if err := Extract(context.Background(), &buf, dest, Options{}); err != nil {
+		t.Fatal(err)
+	}
+	checkTree(t, dest, map[string]string{"empty": "", "short": "short", "long": long})
+}
+
+func TestFinderEmptyFile(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, map[string]string{"empty": ""})
+	var sp spooler
+	defer sp.Close()
+	ft, err := findFileTable(context.Background(), root, &Options{}, &sp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ft) != 1 || len(sp.files) != 0 {
+		t.Errorf("got %d files and %d spooled, want ordinary empty file not spooled", len(ft), len(sp.files))
+	}
+}
@@ -0,0 +1,34 @@
+package rawpack
+
+import (
+	"context"
+	"io"
+)
+
+// Verify reads all files of archive from r and checks, that archive is not truncated,
+// files compressed separately are decompressed
+func Verify(ctx context.Context, r io.Reader, opts Options) error {
+	archive, ft, err := OpenReader(r, opts)
+	if err != nil {
+		return err
+	}
+	defer archive.Close()
+	buf := opts.buffer()
+	for ; err == nil; ft, err = archive.NextFileTable() {
+		if opts.Progress != nil {
+			opts.Progress.Start(ft)
+		}
+		for i := range ft {
+			if err := checkContext(ctx, ""); err != nil {
+				return err
+			}
+			if err := copyEntry(ctx, io.Discard, archive, &ft[i], buf, opts.Progress); err != nil {
+				return err
+			}
+		}
+	}
+	if err != io.EOF {
+		return err
+	}
+	return nil
+}
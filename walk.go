@@ -0,0 +1,211 @@
+package rawpack
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// MissingFilesError is returned, when files listed in Options.Files don't exist
+type MissingFilesError struct {
+	Names []string
+}
+
+func (e *MissingFilesError) Error() string {
+	if len(e.Names) == 1 {
+		return fmt.Sprintf("file %q not found", e.Names[0])
+	}
+	return fmt.Sprintf("%d files not found: %s", len(e.Names), strings.Join(e.Names, ", "))
+}
+
+// finder collects files to pack, each file is added once
+type finder struct {
+	ctx     context.Context
+	root    string
+	opts    *Options
+	exclude *Matcher
+	xattrs  *xattrFilter
+	sp      *spooler
+	files   FileTable
+	names   map[string]bool
+	// virtual maps devices to true, if they are virtual file systems, see isUnknownSize
+	virtual map[uint64]bool
+}
+
+func newFinder(ctx context.Context, root string, opts *Options, sp *spooler) (*finder, error) {
+	if len(root) == 0 {
+		root = "."
+	}
+	exclude, err := CompilePatterns(opts.Exclude, opts.IgnoreCase)
+	if err != nil {
+		return nil, err
+	}
+	xattrs, err := newXattrFilter(opts)
+	if err != nil {
+		return nil, err
+	}
+	return &finder{
+		ctx:     ctx,
+		root:    root,
+		opts:    opts,
+		exclude: exclude,
+		xattrs:  xattrs,
+		sp:      sp,
+		files:   make(FileTable, 0, 32),
+		names:   make(map[string]bool),
+		virtual: make(map[uint64]bool),
+	}, nil
+}
+
+func (fd *finder) add(name, p string, info fs.FileInfo) error {
+	if fd.names[name] {
+		return nil
+	}
+	fd.names[name] = true
+	fd.files = append(fd.files, File{Name: name, Size: uint64(info.Size()), Path: p})
+	f := &fd.files[len(fd.files)-1]
+	if fd.xattrs != nil {
+		if err := fd.xattrs.addXattrs(f, p); err != nil {
+			return err
+		}
+	}
+	unknown, err := isUnknownSize(p, info, fd.virtual)
+	if err != nil {
+		return err
+	}
+	if unknown {
+		return fd.sp.spoolFile(fd.ctx, f)
+	}
+	if fd.opts.Sparse && info.Mode().IsRegular() {
+		return detectSparse(f, p, info.Size())
+	}
+	return nil
+}
+
+// walk adds files from directory at path dir, which is stored with name base ("" for root),
+// and match include, if it is not empty
+func (fd *finder) walk(dir, base string, include *Matcher) error {
+	ig, err := newIgnorer(fd.opts)
+	if err != nil {
+		return err
+	}
+	return filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := checkContext(fd.ctx, ""); err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		name := path.Join(base, filepath.ToSlash(rel))
+		if d.IsDir() {
+			// excluded directories are not walked
+			if p != dir && (fd.exclude.Match(name) || ig.ignored(name, true)) {
+				return fs.SkipDir
+			}
+			if fd.xattrs != nil && name != "." {
+				if err := fd.xattrs.checkDir(name, p); err != nil {
+					return err
+				}
+			}
+			return ig.enter(p, name)
+		}
+		if fd.exclude.Match(name) || ig.ignored(name, false) || !include.Empty() && !include.Match(name) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		return fd.add(name, p, info)
+	})
+}
+
+// addListed adds files from list in its order, directories are added with all their files
+func (fd *finder) addListed(list []string) error {
+	var missing []string
+	for _, it := range list {
+		if err := checkContext(fd.ctx, ""); err != nil {
+			return err
+		}
+		p := it
+		if !filepath.IsAbs(p) {
+			p = filepath.Join(fd.root, p)
+		}
+		// absolute names are stored without leading '/', like in tar
+		name := filepath.Clean(it)
+		name = strings.TrimPrefix(name, filepath.VolumeName(name))
+		name = strings.TrimLeft(filepath.ToSlash(name), "/")
+		if name != "." && !filepath.IsLocal(name) {
+			return fmt.Errorf("unsafe file name %q", it)
+		}
+		info, err := os.Stat(p)
+		if errors.Is(err, fs.ErrNotExist) {
+			missing = append(missing, it)
+			continue
+		} else if err != nil {
+			return err
+		}
+		if fd.exclude.Match(name) {
+			continue
+		}
+		if info.IsDir() {
+			if name == "." {
+				name = ""
+			}
+			if err := fd.walk(p, name, &Matcher{}); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := fd.add(name, p, info); err != nil {
+			return err
+		}
+	}
+	if len(missing) > 0 {
+		return &MissingFilesError{Names: missing}
+	}
+	return nil
+}
+
+// ReadFileList reads names of files separated by new lines, or by NUL characters if null is set.
+// Empty names are skipped.
+func ReadFileList(r io.Reader, null bool) ([]string, error) {
+	sep := byte('\n')
+	if null {
+		sep = 0
+	}
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, 1<<20)
+	s.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+		if i := bytes.IndexByte(data, sep); i >= 0 {
+			return i + 1, data[:i], nil
+		}
+		if atEOF && len(data) > 0 {
+			return len(data), data, nil
+		}
+		return 0, nil, nil
+	})
+	var list []string
+	for s.Scan() {
+		name := s.Text()
+		if !null {
+			name = strings.TrimSuffix(name, "\r")
+		}
+		if len(name) > 0 {
+			list = append(list, name)
+		}
+	}
+	return list, s.Err()
+}
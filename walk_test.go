@@ -0,0 +1,97 @@
+package rawpack
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadFileList(t *testing.T) {
+	tests := []struct {
+		in   string
+		null bool
+		want []string
+	}{
+		{"a\nb c\n\nd", false, []string{"a", "b c", "d"}},
+		{"a\r\nb\r\n", false, []string{"a", "b"}},
+		{"a\x00b\nc\x00\x00", true, []string{"a", "b\nc"}},
+		{"a\r\x00", true, []string{"a\r"}},
+		{"", false, nil},
+	}
+	for _, tt := range tests {
+		got, err := ReadFileList(strings.NewReader(tt.in), tt.null)
+		if err != nil {
+			t.Errorf("ReadFileList(%q): %v", tt.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ReadFileList(%q, %v) = %q, want %q", tt.in, tt.null, got, tt.want)
+		}
+	}
+}
+
+func TestFindFileTableListed(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, testFiles)
+	names := func(opts Options) ([]string, error) {
+		var sp spooler
+		defer sp.Close()
+		ft, err := findFileTable(context.Background(), root, &opts, &sp)
+		var list []string
+		for _, it := range ft {
+			list = append(list, it.Name)
+		}
+		return list, err
+	}
+
+	// files are packed in order of list, directories with all their files, each file once
+	got, err := names(Options{Files: []string{"sub/c.txt", "b.log", "sub", "./a.txt", "b.log"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"sub/c.txt", "b.log", "sub/deep/d.go", "a.txt"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	// absolute names are stored without leading '/'
+	abs := filepath.Join(root, "a.txt")
+	got, err = names(Options{Files: []string{abs}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := strings.TrimLeft(filepath.ToSlash(abs), "/"); len(got) != 1 || got[0] != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	// excluded files are skipped, include patterns select walked files before listed ones
+	got, err = names(Options{Files: []string{"b.log", "sub"}, Exclude: []string{"*.go"}, Include: []string{"a.*"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a.txt", "b.log", "sub/c.txt"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	_, err = names(Options{Files: []string{"a.txt", "missing", "sub/missing"}})
+	var missing *MissingFilesError
+	if !errors.As(err, &missing) || !reflect.DeepEqual(missing.Names, []string{"missing", "sub/missing"}) {
+		t.Errorf("got %v, want MissingFilesError", err)
+	}
+
+	if _, err := names(Options{Files: []string{"../x"}}); err == nil || errors.As(err, &missing) {
+		t.Errorf("got %v, want error for unsafe name", err)
+	}
+}
+
+func TestMissingFilesError(t *testing.T) {
+	if got := (&MissingFilesError{Names: []string{"a"}}).Error(); got != `file "a" not found` {
+		t.Errorf("got %q", got)
+	}
+	if got := (&MissingFilesError{Names: []string{"a", "b"}}).Error(); got != "2 files not found: a, b" {
+		t.Errorf("got %q", got)
+	}
+}
@@ -6,7 +6,8 @@ import (
 )
 
 type Writer struct {
-	out io.Writer
+	out   io.Writer
+	flags FormatFlag
 }
 
 func NewWriter(out io.Writer) *Writer {
@@ -37,10 +38,38 @@ func (w *Writer) writeFileInfo(f *File) (err error) {
 	if err == nil {
 		err = w.writeUint64(f.Size)
 	}
+	if err == nil && w.flags&FlagExtensions != 0 {
+		err = w.writeExtensions(f)
+	}
 	return
 }
 
+func (w *Writer) writeBytes(b []byte) error {
+	err := w.writeUint64(uint64(len(b)))
+	if err == nil {
+		err = w.write(b)
+	}
+	return err
+}
+
+func (w *Writer) writeExtensions(f *File) error {
+	if err := w.writeUint64(uint64(len(f.Extensions))); err != nil {
+		return err
+	}
+	for _, it := range f.Extensions {
+		if err := w.writeBytes([]byte(it.Key)); err != nil {
+			return err
+		}
+		if err := w.writeBytes(it.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteSignature writes signature, its flags define format of file table
 func (w *Writer) WriteSignature(s Signature) error {
+	w.flags = s.Flags()
 	return w.write(s[:])
 }
 
@@ -0,0 +1,92 @@
+package rawpack
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ExtXattrPrefix is prefix of keys of extensions with extended attributes (including POSIX ACLs),
+// it is followed by name of attribute, like "xattr.user.comment"
+const ExtXattrPrefix = "xattr."
+
+// xattrFilter selects extended attributes by Options.XattrInclude and Options.XattrExclude
+type xattrFilter struct {
+	include, exclude *Matcher
+}
+
+// xattrPatterns converts namespaces without '.' to patterns matching all their attributes
+func xattrPatterns(patterns []string) []string {
+	result := make([]string, len(patterns))
+	for i, it := range patterns {
+		if !strings.ContainsAny(it, ".*?[{") {
+			it += ".*"
+		}
+		result[i] = it
+	}
+	return result
+}
+
+// newXattrFilter returns nil, if extended attributes are not enabled
+func newXattrFilter(opts *Options) (*xattrFilter, error) {
+	if !opts.Xattrs {
+		return nil, nil
+	}
+	include, err := CompilePatterns(xattrPatterns(opts.XattrInclude), false)
+	if err != nil {
+		return nil, err
+	}
+	exclude, err := CompilePatterns(xattrPatterns(opts.XattrExclude), false)
+	if err != nil {
+		return nil, err
+	}
+	return &xattrFilter{include: include, exclude: exclude}, nil
+}
+
+func (x *xattrFilter) match(name string) bool {
+	return !x.exclude.Match(name) && (x.include.Empty() || x.include.Match(name))
+}
+
+// addXattrs stores extended attributes of file at path p as extensions of f
+func (x *xattrFilter) addXattrs(f *File, p string) error {
+	attrs, err := readXattrs(p, x.match)
+	if err != nil {
+		return fmt.Errorf("%s: cannot read extended attributes: %w", f.Name, err)
+	}
+	for _, it := range attrs {
+		f.SetExtension(ExtXattrPrefix+it.Key, it.Value)
+	}
+	return nil
+}
+
+// checkDir returns error, if directory name at path p has extended attributes selected by filter.
+// Archive stores attributes only of files, so attributes of directories (default ACLs) would be lost.
+func (x *xattrFilter) checkDir(name, p string) error {
+	attrs, err := readXattrs(p, x.match)
+	if err != nil {
+		return fmt.Errorf("%s: cannot read extended attributes: %w", name, err)
+	}
+	if len(attrs) == 0 {
+		return nil
+	}
+	names := make([]string, len(attrs))
+	for i, it := range attrs {
+		names[i] = it.Key
+	}
+	return fmt.Errorf("%s: extended attributes of directories (%s) are not stored, skip them with exclude filter",
+		name, strings.Join(names, ", "))
+}
+
+// restoreXattrs sets extended attributes stored in extensions of f to file
+func (x *xattrFilter) restoreXattrs(f *File, file *os.File) error {
+	for _, it := range f.Extensions {
+		name, ok := strings.CutPrefix(it.Key, ExtXattrPrefix)
+		if !ok || !x.match(name) {
+			continue
+		}
+		if err := setXattr(file, name, it.Value); err != nil {
+			return fmt.Errorf("%s: cannot set extended attribute %q: %w", f.Name, name, err)
+		}
+	}
+	return nil
+}
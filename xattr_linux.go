@@ -0,0 +1,72 @@
+package rawpack
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"slices"
+
+	"golang.org/x/sys/unix"
+)
+
+// readXattrs reads extended attributes of file at path p sorted by name, which are selected by match
+func readXattrs(p string, match func(name string) bool) ([]Extension, error) {
+	var list []byte
+	for {
+		n, err := unix.Listxattr(p, nil)
+		if errors.Is(err, unix.ENOTSUP) {
+			return nil, nil
+		} else if err != nil {
+			return nil, err
+		}
+		list = make([]byte, n)
+		n, err = unix.Listxattr(p, list)
+		if errors.Is(err, unix.ERANGE) {
+			// attributes are changed between calls
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		list = list[:n]
+		break
+	}
+	var names []string
+	for _, it := range bytes.Split(list, []byte{0}) {
+		if name := string(it); len(name) > 0 && match(name) {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	attrs := make([]Extension, 0, len(names))
+	for _, name := range names {
+		value, err := getXattr(p, name)
+		if errors.Is(err, unix.ENODATA) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		attrs = append(attrs, Extension{Key: name, Value: value})
+	}
+	return attrs, nil
+}
+
+func getXattr(p, name string) ([]byte, error) {
+	for {
+		n, err := unix.Getxattr(p, name, nil)
+		if err != nil {
+			return nil, err
+		}
+		value := make([]byte, n)
+		n, err = unix.Getxattr(p, name, value)
+		if errors.Is(err, unix.ERANGE) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		return value[:n], nil
+	}
+}
+
+func setXattr(f *os.File, name string, value []byte) error {
+	return unix.Fsetxattr(int(f.Fd()), name, value, 0)
+}
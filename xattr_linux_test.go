@@ -0,0 +1,88 @@
+package rawpack
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+// setTestXattr sets attribute, test is skipped, if file system doesn't support them
+func setTestXattr(t *testing.T, p, name, value string) {
+	t.Helper()
+	if err := unix.Setxattr(p, name, []byte(value), 0); errors.Is(err, unix.ENOTSUP) || errors.Is(err, unix.EPERM) {
+		t.Skip("extended attributes are not supported:", err)
+	} else if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestXattrsRoundTrip(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, testFiles)
+	setTestXattr(t, filepath.Join(root, "a.txt"), "user.comment", "alpha")
+	setTestXattr(t, filepath.Join(root, "a.txt"), "user.skip", "skipped")
+	setTestXattr(t, filepath.Join(root, "sub/c.txt"), "user.comment", "gamma")
+
+	var buf bytes.Buffer
+	opts := Options{Xattrs: true, XattrExclude: []string{"user.skip"}}
+	if err := PackDir(context.Background(), &buf, root, opts); err != nil {
+		t.Fatal(err)
+	}
+	for _, jobs := range []int{1, 4} {
+		dest := t.TempDir()
+		if err := Extract(context.Background(), bytes.NewReader(buf.Bytes()), dest, Options{Xattrs: true, Jobs: jobs}); err != nil {
+			t.Fatal(err)
+		}
+		checkTree(t, dest, testFiles)
+		for name, want := range map[string]map[string]string{
+			"a.txt":     {"user.comment": "alpha"},
+			"sub/c.txt": {"user.comment": "gamma"},
+			"b.log":     {},
+		} {
+			attrs, err := readXattrs(filepath.Join(dest, name), func(string) bool { return true })
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := make(map[string]string)
+			for _, it := range attrs {
+				got[it.Key] = string(it.Value)
+			}
+			if len(got) != len(want) || got["user.comment"] != want["user.comment"] {
+				t.Errorf("jobs %d, %s: got attributes %q, want %q", jobs, name, got, want)
+			}
+		}
+	}
+
+	// attributes are not restored without Xattrs
+	dest := t.TempDir()
+	if err := Extract(context.Background(), bytes.NewReader(buf.Bytes()), dest, Options{}); err != nil {
+		t.Fatal(err)
+	}
+	if attrs, err := readXattrs(filepath.Join(dest, "a.txt"), func(string) bool { return true }); err != nil || len(attrs) != 0 {
+		t.Errorf("got attributes %v, %v", attrs, err)
+	}
+}
+
+func TestXattrsDirectory(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, testFiles)
+	setTestXattr(t, filepath.Join(root, "sub/deep"), "user.dir", "x")
+
+	var buf bytes.Buffer
+	err := PackDir(context.Background(), &buf, root, Options{Xattrs: true})
+	if err == nil || !strings.Contains(err.Error(), "sub/deep") || !strings.Contains(err.Error(), "user.dir") {
+		t.Errorf("got %v, want error for attributes of directory", err)
+	}
+	if err := PackDir(context.Background(), &buf, root, Options{Xattrs: true, XattrExclude: []string{"user.dir"}}); err != nil {
+		t.Error(err)
+	}
+	// attributes of directories are not checked without Xattrs
+	if err := PackDir(context.Background(), &buf, root, Options{}); err != nil {
+		t.Error(err)
+	}
+}
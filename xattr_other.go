@@ -0,0 +1,17 @@
+//go:build !linux
+
+package rawpack
+
+import (
+	"errors"
+	"os"
+)
+
+// readXattrs returns nil, extended attributes are supported only on Linux
+func readXattrs(p string, match func(name string) bool) ([]Extension, error) {
+	return nil, nil
+}
+
+func setXattr(f *os.File, name string, value []byte) error {
+	return errors.New("extended attributes are not supported on this platform")
+}
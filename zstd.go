@@ -0,0 +1,494 @@
+package rawpack
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/shirou/gopsutil/v3/mem"
+)
+
+var zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+
+const reproducibleWindowSize = 8 << 20 // 8MB
+
+// ZstdOptions describes parameters of ZSTD compression, it is created by ParseZstdOptions
+type ZstdOptions struct {
+	memory        *uint64
+	level         zstd.EncoderLevel
+	threads       byte
+	memoryPercent bool
+	forceAuto     bool
+	noCRC         bool
+	lowMem        bool
+	zeroFrames    bool
+	// contentSize enables writing of size of content to frame header
+	contentSize bool
+	// rules are levels of files compressed separately (see Options.EntryCodec), the last matching rule wins
+	rules []zstdRule
+}
+
+// zstdRule is level of files matching pattern
+type zstdRule struct {
+	pattern *Pattern
+	level   zstd.EncoderLevel
+}
+
+// ParseZstdOptions parses options in format of rpk's '--zstd=' flag, empty string means auto parameters.
+// Options are separated by ',', rules of levels for files compressed separately follow after ';'
+// in format 'pattern:l=level', for example "l=mid,t=4;*.log:l=best".
+func ParseZstdOptions(s string) (*ZstdOptions, error) {
+	i := &ZstdOptions{
+		level:   zstd.SpeedDefault,
+		threads: 1,
+	}
+	if len(s) == 0 {
+		i.forceAuto = true
+		return i, nil
+	}
+	explicit := ""
+	for _, section := range strings.Split(s, ";") {
+		if pattern, rule, ok := strings.Cut(section, ":"); ok {
+			if err := i.parseRule(pattern, rule); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		for _, it := range strings.Split(section, ",") {
+			key, err := i.parseOption(it)
+			if err != nil {
+				return nil, err
+			}
+			if key == "l" || key == "t" || key == "m" {
+				explicit = key
+			}
+		}
+	}
+	if i.forceAuto && len(explicit) > 0 {
+		return nil, fmt.Errorf("ZSTD option '%s=' cannot be used with 'auto'", explicit)
+	}
+	return i, nil
+}
+
+// parseOption parses option 'key=value' and returns its key
+func (i *ZstdOptions) parseOption(s string) (string, error) {
+	key, value, hasValue := strings.Cut(s, "=")
+	invalid := func(expected string) error {
+		return fmt.Errorf("invalid ZSTD option %q: expected %s", s, expected)
+	}
+	var err error
+	switch key {
+	case "auto":
+		if hasValue {
+			return key, invalid("'auto' without value")
+		}
+		i.forceAuto = true
+	case "l":
+		if i.level, err = parseZstdLevel(value); err != nil {
+			return key, invalid(err.Error())
+		}
+	case "t":
+		n, err := strconv.ParseUint(value, 10, 8)
+		if err != nil {
+			return key, invalid("threads count 0..255 (0 means count of CPUs)")
+		}
+		i.threads = byte(n)
+	case "m":
+		if err := i.parseMemory(value); err != nil {
+			return key, invalid(err.Error())
+		}
+	case "crc", "lowmem", "zeroframes", "fcs":
+		on := true
+		if hasValue {
+			switch value {
+			case "on":
+			case "off":
+				on = false
+			default:
+				return key, invalid("'on' or 'off'")
+			}
+		}
+		switch key {
+		case "crc":
+			i.noCRC = !on
+		case "lowmem":
+			i.lowMem = on
+		case "zeroframes":
+			i.zeroFrames = on
+		case "fcs":
+			i.contentSize = on
+		}
+	default:
+		return key, fmt.Errorf("unknown ZSTD option %q, expected 'l', 't', 'm', 'crc', 'lowmem', 'zeroframes', 'fcs' or 'auto'", key)
+	}
+	return key, nil
+}
+
+// parseZstdLevel parses named level, or level of reference implementation 1..22
+func parseZstdLevel(s string) (zstd.EncoderLevel, error) {
+	switch s {
+	case "low":
+		return zstd.SpeedFastest, nil
+	case "mid":
+		return zstd.SpeedDefault, nil
+	case "high":
+		return zstd.SpeedBetterCompression, nil
+	case "best":
+		return zstd.SpeedBestCompression, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 1 || n > 22 {
+		return 0, errors.New("'low', 'mid', 'high', 'best' or level 1..22")
+	}
+	return zstd.EncoderLevelFromZstd(n), nil
+}
+
+// parseMemory parses size with suffix G, M, K and optional B, or percent of free memory
+func (i *ZstdOptions) parseMemory(s string) error {
+	i.memoryPercent = strings.HasSuffix(s, "%")
+	s = strings.TrimSuffix(s, "%")
+	shift := 0
+	if !i.memoryPercent {
+		s = strings.TrimSuffix(s, "B")
+		if l := len(s); l > 0 {
+			switch s[l-1] {
+			case 'G':
+				shift = 30
+			case 'M':
+				shift = 20
+			case 'K':
+				shift = 10
+			}
+			if shift != 0 {
+				s = s[:l-1]
+			}
+		}
+	}
+	n, err := strconv.ParseUint(s, 10, 64)
+	switch {
+	case err != nil:
+		return errors.New("size with suffix G, M, K, or percent of free memory")
+	case i.memoryPercent && (n == 0 || n > 100):
+		return errors.New("percent of free memory 1..100")
+	case n == 0 || n > (1<<63)>>shift:
+		return errors.New("non-zero size, which fits in 64 bits")
+	}
+	i.memory = new(uint64)
+	*i.memory = n << shift
+	return nil
+}
+
+// parseRule parses rule 'pattern:l=level'
+func (i *ZstdOptions) parseRule(pattern, s string) error {
+	key, value, _ := strings.Cut(s, "=")
+	if key != "l" {
+		return fmt.Errorf("invalid ZSTD rule %q: expected 'l=' after ':'", pattern+":"+s)
+	}
+	level, err := parseZstdLevel(value)
+	if err != nil {
+		return fmt.Errorf("invalid ZSTD rule %q: expected %w", pattern+":"+s, err)
+	}
+	p, err := CompilePattern(pattern, false)
+	if err != nil {
+		return fmt.Errorf("invalid ZSTD rule %q: %w", pattern+":"+s, err)
+	}
+	i.rules = append(i.rules, zstdRule{pattern: p, level: level})
+	return nil
+}
+
+// fileLevel returns level of file compressed separately
+func (i *ZstdOptions) fileLevel(name string) zstd.EncoderLevel {
+	level := zstd.SpeedDefault
+	if !i.forceAuto {
+		level = i.level
+	}
+	for _, it := range i.rules {
+		if it.pattern.Match(name) {
+			level = it.level
+		}
+	}
+	return level
+}
+
+func (i *ZstdOptions) encoderOptions() []zstd.EOption {
+	return []zstd.EOption{
+		zstd.WithEncoderCRC(!i.noCRC),
+		zstd.WithLowerEncoderMem(i.lowMem),
+		zstd.WithZeroFrames(i.zeroFrames),
+	}
+}
+
+// entryWriter compresses file compressed separately with dictionary dict (may be nil),
+// size is written to frame header with 'fcs', if it is not negative
+func (i *ZstdOptions) entryWriter(w io.Writer, dict []byte, name string, size int64) (*zstd.Encoder, error) {
+	options := []zstd.EOption{zstd.WithEncoderConcurrency(1)}
+	if i == nil {
+		i = &ZstdOptions{forceAuto: true}
+	}
+	options = append(options, i.encoderOptions()...)
+	options = append(options, zstd.WithEncoderLevel(i.fileLevel(name)))
+	if dict != nil {
+		options = append(options, zstd.WithEncoderDict(dict))
+	}
+	if i.memory != nil && !i.memoryPercent && !i.forceAuto {
+		options = append(options, zstd.WithWindowSize(int(windowSize(*i.memory))))
+	}
+	zw, err := zstd.NewWriter(nil, options...)
+	if err != nil {
+		return nil, err
+	}
+	if i.contentSize && size >= 0 {
+		zw.ResetContentSize(w, size)
+	} else {
+		zw.Reset(w)
+	}
+	return zw, nil
+}
+
+func (i *ZstdOptions) clone() *ZstdOptions {
+	c := *i
+	c.rules = slices.Clone(i.rules)
+	if i.memory != nil {
+		c.memory = new(uint64)
+		*c.memory = *i.memory
+	}
+	return &c
+}
+
+func (i *ZstdOptions) validateParameters(writeSpeed float64, size uint64, isWrite bool) error {
+	freeMem, err := mem.VirtualMemory()
+	if err != nil {
+		return err
+	}
+	if i.forceAuto {
+		threadsCount, err := func() (byte, error) {
+			maxThreadsByMem := max(1, int(freeMem.Available/(10<<20))) // 10MB per thread
+
+			maxThreadsByWriteSpeed := 1
+			switch {
+			case writeSpeed > 300:
+				maxThreadsByWriteSpeed = 8
+			case writeSpeed > 150:
+				maxThreadsByWriteSpeed = 6
+			case writeSpeed > 50:
+				maxThreadsByWriteSpeed = 4
+			default:
+				maxThreadsByWriteSpeed = 2
+			}
+
+			return byte(min(runtime.NumCPU(), maxThreadsByMem, maxThreadsByWriteSpeed, 255)), nil
+		}()
+		if err != nil {
+			return err
+		}
+		i.threads = threadsCount
+
+		if isWrite {
+			switch {
+			case size < 1<<20:
+				i.level = zstd.SpeedFastest
+			case size < 10<<20:
+				i.level = zstd.SpeedDefault
+			default:
+				i.level = zstd.SpeedBetterCompression
+			}
+		}
+		i.memory = new(uint64)
+		*i.memory = uint64(float64(freeMem.Available) * 0.7)
+	} else {
+		if i.threads == 0 {
+			i.threads = byte(runtime.NumCPU())
+		} else {
+			i.threads = byte(min(runtime.NumCPU(), int(i.threads)))
+		}
+		if i.memoryPercent {
+			i.memoryPercent = false
+			*i.memory = uint64(float64(freeMem.Available) / 100 * min(float64(*i.memory), 100))
+		}
+	}
+	if i.memory == nil {
+		i.memory = new(uint64)
+		*i.memory = 4 << 30 // 4GB
+	}
+	if isWrite {
+		*i.memory = windowSize(*i.memory)
+	} else {
+		i.threads = min(i.threads, 4)
+		*i.memory = min(1<<63, max(1<<10, *i.memory))
+	}
+	return nil
+}
+
+// windowSize rounds n down to power of 2 in range of ZSTD window sizes
+func windowSize(n uint64) uint64 {
+	if n != 0 {
+		n |= n >> 1
+		n |= n >> 2
+		n |= n >> 4
+		n |= n >> 8
+		n |= n >> 16
+		n |= n >> 32
+		n -= n >> 1
+	}
+	return min(zstd.MaxWindowSize, max(zstd.MinWindowSize, n))
+}
+
+// reproducibleParameters sets parameters of compression independent of machine (free memory, storage speed),
+// so the same input is compressed to the same output everywhere
+func (i *ZstdOptions) reproducibleParameters() error {
+	if i.forceAuto {
+		i.level = zstd.SpeedDefault
+		i.threads = 0
+		i.memory = nil
+	}
+	if i.memoryPercent {
+		return errors.New("window size in percents of memory cannot be used in reproducible mode")
+	}
+	if i.memory == nil {
+		i.memory = new(uint64)
+		*i.memory = reproducibleWindowSize
+	}
+	*i.memory = windowSize(*i.memory)
+	if i.threads == 0 {
+		i.threads = byte(min(runtime.NumCPU(), 255))
+	}
+	return nil
+}
+
+// wrapWriter compresses w with dictionary, if it is not nil, see writeDictFrame.
+// size is size of archive, it is written to frame header with 'fcs'.
+func (i *ZstdOptions) wrapWriter(w io.Writer, writeSpeed float64, size uint64, reproducible bool, dict []byte) (io.Writer, io.Closer, error) {
+	if i == nil {
+		return w, nil, nil
+	}
+	if len(i.rules) > 0 {
+		return nil, nil, errors.New("rules of ZSTD levels require compression of each file separately")
+	}
+
+	i = i.clone()
+	var err error
+	if reproducible {
+		err = i.reproducibleParameters()
+	} else {
+		err = i.validateParameters(writeSpeed, size, true)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	options := []zstd.EOption{
+		zstd.WithWindowSize(int(*i.memory)),
+		zstd.WithEncoderLevel(i.level),
+		zstd.WithEncoderConcurrency(int(i.threads)),
+	}
+	options = append(options, i.encoderOptions()...)
+	if dict != nil {
+		options = append(options, zstd.WithEncoderDict(dict))
+	}
+	zw, err := zstd.NewWriter(nil, options...)
+	if err != nil {
+		return nil, nil, err
+	}
+	if i.contentSize {
+		zw.ResetContentSize(w, int64(size))
+	} else {
+		zw.Reset(w)
+	}
+	return zw, zw, nil
+}
+
+type zstdReadWrapper struct {
+	r   io.Reader
+	tmp []byte
+}
+
+func (w *zstdReadWrapper) Read(b []byte) (int, error) {
+	if w.tmp != nil {
+		avail := len(w.tmp)
+		request := len(b)
+		if request <= avail {
+			copy(b, w.tmp[:request])
+			avail -= request
+			if avail == 0 {
+				w.tmp = nil
+			} else {
+				w.tmp = w.tmp[request:]
+			}
+			return request, nil
+		} else {
+			copy(b, w.tmp)
+			n, err := w.r.Read(b[avail:])
+			n += avail
+			w.tmp = nil
+			return n, err
+		}
+	}
+	return w.r.Read(b)
+}
+
+// wrapReader decompresses r, ZSTD dictionary stored at its start is returned
+func (i *ZstdOptions) wrapReader(r io.Reader, writeSpeed float64) (io.Reader, io.Closer, []byte, error) {
+	magic := make([]byte, 4)
+	readMagic := func() error {
+		n, err := io.ReadFull(r, magic)
+		if n < len(magic) {
+			if err == nil || err == io.EOF || err == io.ErrUnexpectedEOF {
+				err = errors.New("cannot detect rawpack or ZSTD signature")
+			}
+			return err
+		}
+		return nil
+	}
+	if err := readMagic(); err != nil {
+		return nil, nil, nil, err
+	}
+	var dict []byte
+	if isSkippableFrame(magic) {
+		var err error
+		if dict, err = readDictFrame(r); err != nil {
+			return nil, nil, nil, err
+		}
+		if err := readMagic(); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	r = &zstdReadWrapper{
+		r:   r,
+		tmp: magic,
+	}
+	if !bytes.Equal(magic, zstdMagic) && (i == nil || dict != nil) {
+		// dictionary of uncompressed archive is used by files compressed separately
+		return r, nil, dict, nil
+	}
+	if i == nil {
+		i = &ZstdOptions{
+			forceAuto: true,
+		}
+	} else {
+		i = i.clone()
+	}
+
+	if err := i.validateParameters(writeSpeed, 0, false); err != nil {
+		return nil, nil, nil, err
+	}
+
+	options := []zstd.DOption{
+		zstd.WithDecoderConcurrency(int(i.threads)),
+		zstd.WithDecoderMaxMemory(*i.memory),
+	}
+	if dict != nil {
+		options = append(options, zstd.WithDecoderDicts(dict))
+	}
+	zr, err := zstd.NewReader(r, options...)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	rc := zr.IOReadCloser()
+	return rc, rc, dict, nil
+}
@@ -0,0 +1,180 @@
+package rawpack
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math"
+
+	"github.com/klauspost/compress/dict"
+)
+
+const (
+	// DefaultDictSize is default size of trained ZSTD dictionary
+	DefaultDictSize = 112 << 10 // 112KB
+
+	// maxDictSize limits size of dictionary read from archive
+	maxDictSize = 16 << 20 // 16MB
+	// dictSampleSize limits size of sample taken from one file
+	dictSampleSize = 128 << 10 // 128KB
+	// dictSamplesRatio is ratio of total size of samples to size of dictionary
+	dictSamplesRatio = 100
+)
+
+var (
+	// skippableFrameMagic is magic of ZSTD skippable frame with the lowest 4 bits cleared
+	skippableFrameMagic = uint32(0x184D2A50)
+	zstdDictMagic       = []byte{0x37, 0xa4, 0x30, 0xec}
+)
+
+func isSkippableFrame(magic []byte) bool {
+	return binary.LittleEndian.Uint32(magic)&^0xf == skippableFrameMagic
+}
+
+// writeDictFrame writes dictionary in ZSTD skippable frame, which is ignored by other ZSTD decoders
+func writeDictFrame(w io.Writer, d []byte) error {
+	var header [8]byte
+	binary.LittleEndian.PutUint32(header[:], skippableFrameMagic)
+	binary.LittleEndian.PutUint32(header[4:], uint32(len(d)))
+	if _, err := w.Write(header[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(d)
+	return err
+}
+
+// readDictFrame reads the rest of skippable frame after magic, returns nil if frame doesn't contain dictionary
+func readDictFrame(r io.Reader) ([]byte, error) {
+	var size [4]byte
+	if _, err := io.ReadFull(r, size[:]); err != nil {
+		return nil, err
+	}
+	n := binary.LittleEndian.Uint32(size[:])
+	if n > maxDictSize {
+		_, err := io.CopyN(io.Discard, r, int64(n))
+		return nil, err
+	}
+	d := make([]byte, n)
+	if _, err := io.ReadFull(r, d); err != nil {
+		return nil, fmt.Errorf("cannot read ZSTD dictionary: %w", err)
+	}
+	if !bytes.HasPrefix(d, zstdDictMagic) {
+		return nil, nil
+	}
+	return d, nil
+}
+
+// dictFrameSize returns size of frame of dictionary d written by writeDictFrame, 0 for nil
+func dictFrameSize(d []byte) int64 {
+	if d == nil {
+		return 0
+	}
+	return 8 + int64(len(d))
+}
+
+// readDictPrefix reads dictionary frame at the start of uncompressed archive with files compressed
+// separately, nil is returned if r doesn't start with dictionary or it is followed by ZSTD stream
+func readDictPrefix(r io.ReaderAt) ([]byte, error) {
+	magic := make([]byte, len(zstdMagic))
+	if n, _ := r.ReadAt(magic, 0); n < len(magic) || !isSkippableFrame(magic) {
+		return nil, nil
+	}
+	d, err := readDictFrame(io.NewSectionReader(r, int64(len(magic)), math.MaxInt64-int64(len(magic))))
+	if err != nil || d == nil {
+		return nil, err
+	}
+	if n, _ := r.ReadAt(magic, dictFrameSize(d)); n == len(magic) && bytes.Equal(magic, zstdMagic) {
+		return nil, nil
+	}
+	return d, nil
+}
+
+// ValidateZstdDict checks, that d is ZSTD dictionary
+func ValidateZstdDict(d []byte) error {
+	if !bytes.HasPrefix(d, zstdDictMagic) {
+		return errors.New("invalid ZSTD dictionary")
+	}
+	if len(d) > maxDictSize {
+		return fmt.Errorf("ZSTD dictionary is too large (max %d bytes)", maxDictSize)
+	}
+	return nil
+}
+
+// sampleFiles reads beginnings of files of ft, until total size of samples reaches limit
+func sampleFiles(ctx context.Context, ft FileTable, limit int) ([][]byte, error) {
+	var samples [][]byte
+	total := 0
+	for i := range ft {
+		if total >= limit {
+			break
+		}
+		if err := checkContext(ctx, ft[i].Name); err != nil {
+			return nil, err
+		}
+		if ft[i].Size == 0 {
+			continue
+		}
+		rc, err := ft[i].Read()
+		if err != nil {
+			return nil, err
+		}
+		sample := make([]byte, min(ft[i].Size, dictSampleSize))
+		n, err := io.ReadFull(rc, sample)
+		_ = rc.Close()
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return nil, fmt.Errorf("%s: %w", ft[i].Name, err)
+		}
+		samples = append(samples, sample[:n])
+		total += n
+	}
+	return samples, nil
+}
+
+// dictID derives ID of dictionary from samples, so the same samples give the same dictionary
+func dictID(samples [][]byte) uint32 {
+	h := fnv.New32a()
+	for _, it := range samples {
+		_, _ = h.Write(it)
+	}
+	// IDs below 32768 and above 2^31 are reserved
+	return 32768 + h.Sum32()%(1<<31-32768)
+}
+
+// trainZstdDict trains ZSTD dictionary of size from contents of files of ft
+func trainZstdDict(ctx context.Context, ft FileTable, size int) ([]byte, error) {
+	if size <= 0 {
+		size = DefaultDictSize
+	}
+	samples, err := sampleFiles(ctx, ft, size*dictSamplesRatio)
+	if err != nil {
+		return nil, err
+	}
+	if len(samples) == 0 {
+		return nil, errors.New("cannot train ZSTD dictionary: no data")
+	}
+	d, err := dict.BuildZstdDict(samples, dict.Options{
+		MaxDictSize: size,
+		HashBytes:   6,
+		ZstdDictID:  dictID(samples),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot train ZSTD dictionary: %w", err)
+	}
+	return d, nil
+}
+
+// TrainZstdDict trains ZSTD dictionary of size (DefaultDictSize if it is 0) from files found in root,
+// like in PackDir. Dictionary may be used in Options.ZstdDict for archives of similar files.
+func TrainZstdDict(ctx context.Context, root string, opts Options, size int) ([]byte, error) {
+	var sp spooler
+	defer sp.Close()
+	ft, err := findFileTable(ctx, root, &opts, &sp)
+	if err != nil {
+		return nil, err
+	}
+	return trainZstdDict(ctx, ft, size)
+}
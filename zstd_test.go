@@ -0,0 +1,151 @@
+package rawpack
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestParseZstdOptions(t *testing.T) {
+	type parsed struct {
+		level         zstd.EncoderLevel
+		threads       byte
+		memory        uint64
+		memoryPercent bool
+		auto          bool
+		noCRC         bool
+		lowMem        bool
+		zeroFrames    bool
+		contentSize   bool
+		rules         int
+	}
+	def := parsed{level: zstd.SpeedDefault, threads: 1}
+	with := func(f func(p *parsed)) parsed {
+		p := def
+		f(&p)
+		return p
+	}
+	tests := []struct {
+		s    string
+		want parsed
+	}{
+		{"", with(func(p *parsed) { p.auto = true })},
+		{"auto", with(func(p *parsed) { p.auto = true })},
+		{"l=low", with(func(p *parsed) { p.level = zstd.SpeedFastest })},
+		{"l=mid", def},
+		{"l=high", with(func(p *parsed) { p.level = zstd.SpeedBetterCompression })},
+		{"l=best", with(func(p *parsed) { p.level = zstd.SpeedBestCompression })},
+		{"l=1", with(func(p *parsed) { p.level = zstd.SpeedFastest })},
+		{"l=19", with(func(p *parsed) { p.level = zstd.SpeedBestCompression })},
+		{"t=0", with(func(p *parsed) { p.threads = 0 })},
+		{"t=255", with(func(p *parsed) { p.threads = 255 })},
+		{"m=8M", with(func(p *parsed) { p.memory = 8 << 20 })},
+		{"m=1GB", with(func(p *parsed) { p.memory = 1 << 30 })},
+		{"m=512", with(func(p *parsed) { p.memory = 512 })},
+		{"m=50%", with(func(p *parsed) { p.memory, p.memoryPercent = 50, true })},
+		{"crc=off", with(func(p *parsed) { p.noCRC = true })},
+		{"crc", def},
+		{"lowmem,zeroframes=on,fcs", with(func(p *parsed) { p.lowMem, p.zeroFrames, p.contentSize = true, true, true })},
+		{"fcs=off", def},
+		{"l=high,t=4,m=64M", with(func(p *parsed) { p.level, p.threads, p.memory = zstd.SpeedBetterCompression, 4, 64<<20 })},
+		{"l=low;*.log:l=best;*.txt:l=3", with(func(p *parsed) { p.level, p.rules = zstd.SpeedFastest, 2 })},
+		{"auto,crc=off", with(func(p *parsed) { p.auto, p.noCRC = true, true })},
+		{"auto;*.log:l=best", with(func(p *parsed) { p.auto, p.rules = true, 1 })},
+	}
+	for _, tt := range tests {
+		z, err := ParseZstdOptions(tt.s)
+		if err != nil {
+			t.Errorf("ParseZstdOptions(%q): %v", tt.s, err)
+			continue
+		}
+		got := parsed{
+			level:         z.level,
+			threads:       z.threads,
+			memoryPercent: z.memoryPercent,
+			auto:          z.forceAuto,
+			noCRC:         z.noCRC,
+			lowMem:        z.lowMem,
+			zeroFrames:    z.zeroFrames,
+			contentSize:   z.contentSize,
+			rules:         len(z.rules),
+		}
+		if z.memory != nil {
+			got.memory = *z.memory
+		}
+		if got != tt.want {
+			t.Errorf("ParseZstdOptions(%q) = %+v, want %+v", tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestParseZstdOptionsErrors(t *testing.T) {
+	for _, s := range []string{
+		"l=", "l=0", "l=23", "l=fast", "t=-1", "t=256", "m=", "m=0", "m=0%", "m=101%", "m=1X", "m=99999999999G",
+		"crc=yes", "auto=on", "x=1", "l=low,", ",", "auto,l=low", "t=2,auto",
+		"*.log:t=2", "*.log:l=fast", "[*.log:l=low",
+	} {
+		if _, err := ParseZstdOptions(s); err == nil {
+			t.Errorf("ParseZstdOptions(%q): expected error", s)
+		}
+	}
+}
+
+func TestZstdFileLevel(t *testing.T) {
+	z, err := ParseZstdOptions("l=low;*.log:l=best;debug.log:l=mid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]zstd.EncoderLevel{
+		"a.txt":         zstd.SpeedFastest,
+		"a.log":         zstd.SpeedBestCompression,
+		"sub/debug.log": zstd.SpeedDefault,
+	}
+	for name, want := range tests {
+		if got := z.fileLevel(name); got != want {
+			t.Errorf("fileLevel(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestZstdEntryWriterRoundTrip(t *testing.T) {
+	z, err := ParseZstdOptions("l=high,crc=off,fcs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := bytes.Repeat([]byte("zstd round trip\n"), 4096)
+	var buf bytes.Buffer
+	w, err := z.entryWriter(&buf, nil, "a.txt", int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	var header zstd.Header
+	if err := header.Decode(buf.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	if !header.HasFCS || header.FrameContentSize != uint64(len(data)) {
+		t.Errorf("frame content size %v %d, want %d", header.HasFCS, header.FrameContentSize, len(data))
+	}
+	if header.HasCheckSum {
+		t.Error("frame has checksum with crc=off")
+	}
+	r, err := zstd.NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Error("decompressed data differs")
+	}
+}